@@ -0,0 +1,116 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains the admin http apis (-srv.adminenable) to commit the
+// pending block now and to pause and resume block commits.
+
+// commitsPaused - true while block commits by flushtimer and blktxmax are
+// paused, transactions keep collecting in blk; guarded by bcmu.
+var commitsPaused bool
+
+// commitInfo - a block committed by an admin action.
+type commitInfo struct {
+	Height    uint64 `json:"height"`
+	BlockHash string `json:"block-hash"`
+	TxCnt     int    `json:"txcnt"`
+}
+
+// adminResult - what an admin action did.
+type adminResult struct {
+	Action    string       `json:"action"`
+	Changed   bool         `json:"changed"` // false if commits were already paused (resumed).
+	Paused    bool         `json:"paused"`
+	Committed []commitInfo `json:"committed"`
+	Pending   int          `json:"pending"` // transactions left in blk.
+}
+
+// commitll - commits b's transactions, in blocks of at most blktxmax (if on)
+// since while paused b may collect more; if all is false a last partial
+// block is left pending. Expects bcmu.Lock mutex to be active.
+func (b *Blk) commitll(all bool) []commitInfo {
+	committed := []commitInfo{}
+	txs := b.Transactions
+	for len(txs) > 0 && (all || (blktxmax > 0 && len(txs) >= blktxmax)) {
+		n := len(txs)
+		if blktxmax > 0 && n > blktxmax {
+			n = blktxmax
+		}
+		b.Transactions, txs = txs[:n:n], txs[n:]
+		b.append2File()
+		committed = append(committed, commitInfo{chainLen() - 1, b.PrevHash, n})
+	}
+	if len(txs) > 0 {
+		b.Transactions = txs
+		atomic.StoreUint64(&curblktxcnt, uint64(len(txs)))
+	}
+	return committed
+}
+
+// adminDo - does admin action 'action' under bcmu.
+func adminDo(action string) *adminResult {
+	defer fn.LogCondTrace(verblvl > 2)()
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	res := &adminResult{Action: action, Committed: []commitInfo{}}
+	switch action {
+	case "commit":
+		stopTimerFlushBlkll()
+		res.Committed = blk.commitll(true)
+		res.Changed = len(res.Committed) > 0
+	case "pause":
+		res.Changed = !commitsPaused
+		commitsPaused = true
+		stopTimerFlushBlkll()
+	case "resume":
+		res.Changed = commitsPaused
+		if commitsPaused {
+			commitsPaused = false
+			res.Committed = blk.commitll(false)
+			if len(blk.Transactions) > 0 {
+				if blkstart.IsZero() {
+					blkstart = clk.Now()
+				}
+				blk.setTimerFlushBlk()
+			}
+		}
+	}
+	res.Paused = commitsPaused
+	res.Pending = len(blk.Transactions)
+	fn.LogCondMsg(verblvl > 0, fmt.Sprintf("admin:%s changed:%v paused:%v committed:%d pending:%d\n",
+		action, res.Changed, res.Paused, len(res.Committed), res.Pending))
+	return res
+}
+
+// cepAdminCommit - client entry point for: POST /admin/commit, commits the
+// pending block now, even while commits are paused.
+func cepAdminCommit(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	sendJSON(w, http.StatusOK, adminDo("commit"), verblvl > 2)
+}
+
+// cepAdminPause - client entry point for: POST /admin/pause, pauses block
+// commits (except /admin/commit and shutdown) until /admin/resume.
+func cepAdminPause(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	sendJSON(w, http.StatusOK, adminDo("pause"), verblvl > 2)
+}
+
+// cepAdminResume - client entry point for: POST /admin/resume, resumes block
+// commits; full blocks (blktxmax) collected while paused are committed now and
+// the block commit timer is started for the rest.
+func cepAdminResume(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	sendJSON(w, http.StatusOK, adminDo("resume"), verblvl > 2)
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/json"
 	"expvar"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"sync/atomic"
@@ -21,6 +20,7 @@ import (
 func publishExpvars() {
 	expvar.Publish("1a-blkctime-duration", expvar.Func(func() interface{} { return blkctimestr }))
 	expvar.Publish("1a-blkfile", expvar.Func(func() interface{} { return blkfile }))
+	expvar.Publish("1a-blkstore", expvar.Func(func() interface{} { return blkstorename }))
 	expvar.Publish("1a-blktxmax", expvar.Func(func() interface{} { return blktxmax }))
 	expvar.Publish("1b-curblktxcnt", expvar.Func(func() interface{} { return atomic.LoadUint64(&curblktxcnt) }))
 	expvar.Publish("1b-totblkappSinv", expvar.Func(func() interface{} { return atomic.LoadUint64(&totblkappSinv) }))
@@ -41,12 +41,3 @@ func decodeBody(r *http.Request, v interface{}) error {
 	defer func() { _ = r.Body.Close() }()
 	return json.NewDecoder(r.Body).Decode(v)
 }
-
-// likely will using for search for existing key feature.
-func decodeFile(fname string, v interface{}) ([]byte, error) {
-	data, err := ioutil.ReadFile(fname)
-	if err == nil {
-		err = json.Unmarshal(data, v)
-	}
-	return data, err
-}
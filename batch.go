@@ -0,0 +1,182 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to batch transaction submission (/tx/batch).
+
+// batchReq - a /tx/batch submission.
+type batchReq struct {
+	Atomic       bool    `json:"atomic"` // true =add all transactions or none.
+	Transactions []txReq `json:"transactions"`
+}
+
+// batchItemErr - why a transaction of a batch was not added.
+type batchItemErr struct {
+	HTTPscode int    `json:"statuscode"`
+	ErrCode   int    `json:"errcode"`
+	ErrMsg    string `json:"errmsg"`
+}
+
+// batchItem - outcome of the transaction at Index in a batch.
+type batchItem struct {
+	Index int           `json:"index"`
+	ID    string        `json:"id,omitempty"` // set if added.
+	Err   *batchItemErr `json:"error,omitempty"`
+}
+
+// batchResult - outcome of a batch, Items are in submission order.
+type batchResult struct {
+	Atomic   bool        `json:"atomic"`
+	Added    int         `json:"added"`
+	Rejected int         `json:"rejected"`
+	Items    []batchItem `json:"items"`
+}
+
+// reject - records transaction 'i' was not added because of terr.
+func (res *batchResult) reject(i int, terr *txErr) {
+	res.Items[i].Err = &batchItemErr{terr.scode, terr.code, terr.msg}
+	res.Rejected++
+}
+
+// scode - http status: 201 if all were added, 207 if some, else that of the
+// first rejected transaction.
+func (res *batchResult) scode() int {
+	switch {
+	case res.Rejected == 0:
+		return http.StatusCreated
+	case res.Added > 0:
+		return http.StatusMultiStatus
+	}
+	for _, item := range res.Items {
+		if item.Err != nil && item.Err.ErrCode != ErrTxBatchAborted {
+			return item.Err.HTTPscode
+		}
+	}
+	return http.StatusBadRequest
+}
+
+// batchSeen - the txs of a batch checked so far, nil outside of a batch.
+type batchSeen struct {
+	ids  map[string]bool   // tx IDs.
+	last map[string]string // key to the ID of its last tx.
+}
+
+func newBatchSeen() *batchSeen {
+	return &batchSeen{ids: make(map[string]bool), last: make(map[string]string)}
+}
+
+// add - records tx was checked.
+func (s *batchSeen) add(tx *txStruct) {
+	s.ids[tx.ID] = true
+	s.last[tx.Key] = tx.ID
+}
+
+// addBatchToBlock - adds txs (nil ones were already rejected) in order to
+// blocks under one bcmu acquisition, committing blocks as blktxmax is reached.
+// Each is checked as tx.addToBlock would, a duplicate or a key's last tx
+// includes an earlier tx of the batch. If atomic none are added unless all can be.
+func addBatchToBlock(txs []*txStruct, res *batchResult) {
+	defer fn.LogCondTrace(verblvl > 2)()
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	batch := newBatchSeen()
+	undo := make(map[string]*keyOwner)
+	for i, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		saveOwner(undo, tx.Key)
+		if terr := checkTxll(tx, batch); terr != nil {
+			res.reject(i, terr)
+			txs[i] = nil
+			continue
+		}
+		batch.add(tx)
+	}
+
+	if res.Atomic && res.Rejected > 0 {
+		restoreOwners(undo)
+		abortBatch(txs, res)
+		return
+	}
+	for i, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		appendTxll(tx)
+		res.Items[i].ID = tx.ID
+		res.Added++
+	}
+}
+
+// abortBatch - rejects the txs of an atomic batch not already rejected.
+func abortBatch(txs []*txStruct, res *batchResult) {
+	terr := &txErr{http.StatusFailedDependency, ErrTxBatchAborted,
+		fmt.Sprintf("atomic batch: %d of %d txs rejected", res.Rejected, len(txs))}
+	for i, tx := range txs {
+		if tx != nil {
+			res.reject(i, terr)
+		}
+	}
+}
+
+// cepTxBatch - client entry point for: POST /tx/batch with a json body of batchReq.
+func cepTxBatch(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	ctype := r.Header.Get("Content-Type")
+	if mtype, _, err := mime.ParseMediaType(ctype); err != nil || mtype != "application/json" {
+		sendHTTPError(w, http.StatusUnsupportedMediaType, ErrJSONdecodeBody,
+			fmt.Sprintf("unsupported content type %q; use application/json", ctype), callerPar())
+		return
+	}
+	var req batchReq
+	if err := decodeBody(r, &req); err != nil {
+		sendHTTPError(w, http.StatusBadRequest, ErrJSONdecodeBody,
+			"error decoding json body: "+err.Error(), callerPar())
+		return
+	}
+	if len(req.Transactions) == 0 {
+		sendClientError(w, http.StatusBadRequest, "Error: batch has no transactions")
+		return
+	}
+
+	// everything not needing bcmu is done before acquiring it.
+	res := &batchResult{Atomic: req.Atomic, Items: make([]batchItem, len(req.Transactions))}
+	txs := make([]*txStruct, len(req.Transactions))
+	for i := range req.Transactions {
+		res.Items[i].Index = i
+		treq := &req.Transactions[i]
+		if treq.Key == "" || treq.Value == "" {
+			res.reject(i, &txErr{http.StatusBadRequest, ErrTxKeyValue,
+				fmt.Sprintf("both tranaction key and value must be set; key=%q value=%q", treq.Key, treq.Value)})
+			continue
+		}
+		tx, terr := treq.newTx()
+		if terr != nil {
+			res.reject(i, terr)
+			continue
+		}
+		txs[i] = tx
+	}
+
+	if res.Atomic && res.Rejected > 0 {
+		abortBatch(txs, res)
+	} else {
+		addBatchToBlock(txs, res)
+	}
+	fn.LogCondMsg(verblvl > 1, fmt.Sprintf("batch: txs:%d added:%d rejected:%d atomic:%v\n",
+		len(txs), res.Added, res.Rejected, res.Atomic))
+
+	sendJSON(w, res.scode(), res, verblvl > 2)
+}
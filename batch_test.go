@@ -0,0 +1,105 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testReqs - returns 'n' unsigned tx submissions with distinct values.
+func testReqs(n int) []txReq {
+	reqs := make([]txReq, n)
+	for i := range reqs {
+		reqs[i] = txReq{Key: "k", Value: fmt.Sprintf("v%d", i)}
+	}
+	return reqs
+}
+
+func TestBatch(t *testing.T) {
+	owner, other := testKey('o'), testKey('x')
+	dup := testReqs(5)
+	dup[3] = dup[0]
+	empty := testReqs(5)
+	empty[2].Value = ""
+
+	tests := []struct {
+		name      string
+		atomic    bool
+		ownership bool
+		reqs      []txReq
+		scode     int
+		codes     []int // error code of each item, 0 if added.
+		blocks    uint64
+		pending   int
+	}{
+		{"atomic split over blocks", true, false, testReqs(5), http.StatusCreated,
+			[]int{0, 0, 0, 0, 0}, 2, 1},
+		{"atomic with a duplicate", true, false, dup, http.StatusConflict,
+			[]int{ErrTxBatchAborted, ErrTxBatchAborted, ErrTxBatchAborted, ErrTxDuplicate, ErrTxBatchAborted}, 0, 0},
+		{"atomic with an empty value", true, false, empty, http.StatusBadRequest,
+			[]int{ErrTxBatchAborted, ErrTxBatchAborted, ErrTxKeyValue, ErrTxBatchAborted, ErrTxBatchAborted}, 0, 0},
+		{"with a duplicate", false, false, dup, http.StatusMultiStatus,
+			[]int{0, 0, 0, ErrTxDuplicate, 0}, 2, 0},
+		{"atomic ownership of an earlier tx", true, true, []txReq{
+			signedReq(owner, "k", "v", "", ""),
+			signedReq(other, "k2", "v", "", ""),
+			{Key: "k", Value: "w"},
+		}, http.StatusForbidden, []int{ErrTxBatchAborted, ErrTxBatchAborted, ErrTxNotOwner}, 0, 0},
+		{"ownership of an earlier tx", false, true, []txReq{
+			signedReq(owner, "k", "v", "", ""),
+			{Key: "k", Value: "w"},
+			signedReq(other, "k", "w", "", ""),
+		}, http.StatusMultiStatus, []int{0, ErrTxNotOwner, ErrTxPrevID}, 0, 1},
+	}
+
+	for _, tc := range tests {
+		newTestChain(t)
+		blktxmax, txownership = 2, tc.ownership
+		body, err := json.Marshal(batchReq{Atomic: tc.atomic, Transactions: tc.reqs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/tx/batch", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		cepTxBatch(w, r)
+
+		var res batchResult
+		if err = json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: response %q err:%v", tc.name, w.Body.String(), err)
+		}
+		if w.Code != tc.scode {
+			t.Errorf("%s: status %d want %d", tc.name, w.Code, tc.scode)
+		}
+		for i, item := range res.Items {
+			code := 0
+			if item.Err != nil {
+				code = item.Err.ErrCode
+			}
+			if code != tc.codes[i] {
+				t.Errorf("%s: item %d code %d want %d", tc.name, i, code, tc.codes[i])
+			}
+		}
+
+		bcmu.Lock()
+		pending, owned := len(blk.Transactions), len(owners)
+		bcmu.Unlock()
+		if n := chainLen(); n != tc.blocks || pending != tc.pending {
+			t.Errorf("%s: blocks:%d pending:%d want %d %d", tc.name, n, pending, tc.blocks, tc.pending)
+		}
+		if tc.atomic && res.Added == 0 && owned != 0 {
+			t.Errorf("%s: aborted batch left %d key owners", tc.name, owned)
+		}
+		blk.flush()
+		if _, verr := verifyChain(testDoc(t)); verr != nil {
+			t.Errorf("%s: verify err:%v", tc.name, verr)
+		}
+	}
+}
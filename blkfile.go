@@ -0,0 +1,200 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to the blockchain file (blkfile).
+
+// invGroup - the blocks appended to blkfile during one invocation, i.e.
+// the value of one "invts-<epoch>" member.
+type invGroup struct {
+	Name   string
+	Blocks []Blk
+}
+
+// blkchainDoc - a decoded blkfile; invocation groups are kept in file order.
+type blkchainDoc []invGroup
+
+// UnmarshalJSON - decodes the blkfile json object member by member since
+// a map would lose the order of the invocation groups.
+func (d *blkchainDoc) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("blkfile: expected '{' got %v", tok)
+	}
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+		g := invGroup{Name: tok.(string)} // object keys are always strings.
+		if err = dec.Decode(&g.Blocks); err != nil {
+			return err
+		}
+		*d = append(*d, g)
+	}
+	_, err = dec.Token() // closing '}'
+	return err
+}
+
+// concat - returns d followed by 'next', e.g. the next segment; an
+// invocation's blocks may continue from the end of d into next.
+func (d blkchainDoc) concat(next blkchainDoc) blkchainDoc {
+	if n := len(d); n > 0 && len(next) > 0 && d[n-1].Name == next[0].Name {
+		d[n-1].Blocks = append(d[n-1].Blocks, next[0].Blocks...)
+		next = next[1:]
+	}
+	return append(d, next...)
+}
+
+// fileStore - blkStore backend keeping blocks in a single blkfile of format fmt.
+type fileStore struct {
+	name   string
+	fmt    blkFormat
+	f      *os.File
+	head   string // hash of the last block, valid if headok.
+	headok bool
+}
+
+func newFileStore() blkStore {
+	if blksegmaxbytes > 0 {
+		return newRotFileStore()
+	}
+	return &fileStore{name: blkfile, fmt: blkfmt}
+}
+
+func (s *fileStore) open() error {
+	var err error
+	// skipped O_APPEND because using seek.
+	s.f, err = os.OpenFile(s.name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	return s.recover()
+}
+
+func (s *fileStore) appendBlk(inv string, first bool, b *Blk) (blkPos, int, error) {
+	bdata, err := json.Marshal(b)
+	if err != nil {
+		return blkPos{}, 0, err
+	}
+	off, n, err := s.fmt.appendBlk(s.f, inv, first, bdata)
+	if err == nil {
+		s.head, s.headok = b.BlockHash, true
+	}
+	return blkPos{off: off, len: int64(len(bdata))}, n, err
+}
+
+func (s *fileStore) closeInv() (int, error) {
+	return s.fmt.closeInv(s.f)
+}
+
+func (s *fileStore) scanBlks(open bool, fn func(inv string, b *Blk, pos blkPos) error) error {
+	data, err := ioutil.ReadFile(s.name)
+	if err != nil {
+		return err
+	}
+	head := ""
+	err = s.fmt.scan(data, open, func(inv string, b *Blk, off, end int64) error {
+		head = b.BlockHash
+		return fn(inv, b, blkPos{off: off, len: end - off})
+	})
+	if err == nil {
+		s.head, s.headok = head, true
+	}
+	return err
+}
+
+func (s *fileStore) readBlk(pos blkPos) (Blk, error) {
+	return readBlkAt(s.f, pos)
+}
+
+// readBlkAt - reads the block at 'pos' of blkfile f.
+func readBlkAt(f *os.File, pos blkPos) (Blk, error) {
+	var b Blk
+	data := make([]byte, pos.len)
+	if _, err := f.ReadAt(data, pos.off); err != nil {
+		return b, err
+	}
+	err := json.Unmarshal(data, &b)
+	return b, err
+}
+
+func (s *fileStore) headHash() (string, error) {
+	if !s.headok {
+		if err := s.scanBlks(false, func(string, *Blk, blkPos) error { return nil }); err != nil {
+			return "", err
+		}
+	}
+	return s.head, nil
+}
+
+func (s *fileStore) sync() error {
+	return s.f.Sync()
+}
+
+func (s *fileStore) size() int64 {
+	fi, err := os.Stat(s.name)
+	if err != nil {
+		logPanic(err)
+	}
+	return fi.Size()
+}
+
+func (s *fileStore) close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// recover - repairs blkfile left behind by a hard killed process, i.e.
+// missing its closing json syntax and/or ending with a partially written
+// block, by truncating it back to its last complete block and re-adding the
+// closing json syntax. A file with no complete block is truncated to empty.
+// A file corrupted anywhere else, or in another -blk.format, is left untouched
+// and a *corruptErr (*formatErr) returned.
+func (s *fileStore) recover() error {
+	defer fn.LogCondTrace(verblvl > 1)()
+	data, err := ioutil.ReadFile(s.name)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	good, closing, complete, err := s.fmt.goodLen(data)
+	if err != nil {
+		return err
+	}
+	if complete {
+		return nil
+	}
+
+	dropped := data[good:]
+	if len(dropped) > 64 {
+		dropped = dropped[:64]
+	}
+	fn.LogCondMsg(true, fmt.Sprintf("blkfile:%q recovering: keeping %d of %d bytes, dropped %d bytes:%q..., adding closing:%q\n",
+		s.name, good, len(data), int64(len(data))-good, dropped, closing))
+
+	if err = s.f.Truncate(good); err != nil {
+		return err
+	}
+	if _, err = s.f.WriteAt([]byte(closing), good); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile - writes 'doc' to blkfile 'name' in format 'bf' as
+// invocations would and returns its contents.
+func writeTestFile(t *testing.T, name string, bf blkFormat, doc blkchainDoc) []byte {
+	t.Helper()
+	s := &fileStore{name: name, fmt: bf}
+	if err := s.open(); err != nil {
+		t.Fatalf("open err:%v", err)
+	}
+	for _, g := range doc {
+		for i := range g.Blocks {
+			if _, _, err := s.appendBlk(g.Name, i == 0, &g.Blocks[i]); err != nil {
+				t.Fatalf("appendBlk err:%v", err)
+			}
+		}
+		if _, err := s.closeInv(); err != nil {
+			t.Fatalf("closeInv err:%v", err)
+		}
+	}
+	if err := s.close(); err != nil {
+		t.Fatalf("close err:%v", err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFileStoreRecover(t *testing.T) {
+	doc := testBlocks(t, 3, 2)
+	// torn - drops the json closing and the end of the last block, as a
+	// process killed while appending it leaves the file.
+	torn := func(d []byte) []byte {
+		d = bytes.TrimSuffix(d, []byte("]}"))
+		return d[:len(d)-20]
+	}
+	// corrupt - breaks the json syntax of the first block.
+	corrupt := func(d []byte) []byte {
+		d = append([]byte{}, d...)
+		d[bytes.Index(d, []byte(`"height"`))] = '@'
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func([]byte) []byte
+		blocks  int  // blocks after recovery.
+		corrupt bool // open fails with a *corruptErr leaving the file untouched.
+	}{
+		{"complete", func(d []byte) []byte { return d }, 3, false},
+		{"no closing", func(d []byte) []byte { return bytes.TrimSuffix(d, []byte("]}")) }, 3, false},
+		{"torn tail", torn, 2, false},
+		{"torn to first block", func(d []byte) []byte { return d[:bytes.Index(d, []byte(`"height"`))+4] }, 0, false},
+		{"mid-file corruption", corrupt, 0, true},
+		{"mid-file corruption and torn tail", func(d []byte) []byte { return torn(corrupt(d)) }, 0, true},
+		{"data after the last block", func(d []byte) []byte {
+			return append(append([]byte{}, d...), []byte("\n{\"x\":1}\n{\"y\":2}\n")...)
+		}, 0, true},
+	}
+
+	dir, err := ioutil.TempDir("", "blkchain-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for _, bf := range []blkFormat{jsonFormat{}, jsonlFormat{}} {
+		for _, tc := range tests {
+			name := filepath.Join(dir, "blkchain"+bf.ext())
+			_ = os.Remove(name)
+			data := tc.mutate(writeTestFile(t, name, bf, doc))
+			if err = ioutil.WriteFile(name, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &fileStore{name: name, fmt: bf}
+			err = s.open()
+			_ = s.close()
+			got, rerr := ioutil.ReadFile(name)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			if tc.corrupt {
+				if _, ok := err.(*corruptErr); !ok {
+					t.Errorf("%s %s: open err:%v want a *corruptErr", bf.ext(), tc.name, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("%s %s: file was changed", bf.ext(), tc.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: open err:%v", bf.ext(), tc.name, err)
+				continue
+			}
+			if len(got) == 0 {
+				if tc.blocks != 0 {
+					t.Errorf("%s %s: file emptied want %d blocks", bf.ext(), tc.name, tc.blocks)
+				}
+				continue
+			}
+			if _, _, complete, err := bf.goodLen(got); err != nil || !complete {
+				t.Errorf("%s %s: recovered file complete:%v err:%v", bf.ext(), tc.name, complete, err)
+				continue
+			}
+			rdoc, err := bf.decode(got, false)
+			if err != nil {
+				t.Errorf("%s %s: decode err:%v", bf.ext(), tc.name, err)
+				continue
+			}
+			n := 0
+			for _, g := range rdoc {
+				n += len(g.Blocks)
+			}
+			if n != tc.blocks {
+				t.Errorf("%s %s: recovered %d blocks want %d", bf.ext(), tc.name, n, tc.blocks)
+			}
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// this file contains the blkfile storage formats (-blk.format).
+
+// blkFormat - layout of the invocation groups and blocks within blkfile.
+type blkFormat interface {
+	// appendBlk - appends block json 'bdata' to f, first is true for the
+	// first block appended during invocation 'inv'; returns the offset of
+	// bdata in f and bytes written.
+	appendBlk(f *os.File, inv string, first bool, bdata []byte) (int64, int, error)
+	// closeInv - writes what ends an invocation's blocks, called at exit if
+	// any block was appended; returns bytes written.
+	closeInv(f *os.File) (int, error)
+	// decode - decodes blkfile 'data', open is true if blocks were appended
+	// during this invocation and closeInv has not been called yet.
+	decode(data []byte, open bool) (blkchainDoc, error)
+	// scan - calls fn with each block of blkfile 'data' in file order, its
+	// invocation and the offsets of its json in data; open as for decode.
+	scan(data []byte, open bool, fn func(inv string, b *Blk, off, end int64) error) error
+	// ext - file name extension used for files of the format.
+	ext() string
+	// goodLen - scans blkfile 'data' returning the length of its leading part
+	// that ends on a complete block (or invocation group) and what must follow
+	// it to make the file valid again; complete is true if data is valid as is.
+	// err is a *corruptErr if what follows that part is not a partially
+	// written final record.
+	goodLen(data []byte) (good int64, closing string, complete bool, err error)
+}
+
+// blkFormats - available -blk.format values.
+var blkFormats = map[string]blkFormat{
+	"json":  jsonFormat{},
+	"jsonl": jsonlFormat{},
+}
+
+// formatOf - returns the -blk.format blkfile 'data' is in going by its first
+// record, "" if data is too short to tell.
+func formatOf(data []byte) string {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	for _, f := range []struct{ name, prefix string }{
+		{"json", `{"invts-`},
+		{"jsonl", `{"invocation":`},
+	} {
+		if n := len(f.prefix); len(data) >= n && string(data[:n]) == f.prefix {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// formatErr - blkfile is in another -blk.format than the one in use.
+type formatErr struct {
+	got, want string
+}
+
+func (e *formatErr) Error() string {
+	return fmt.Sprintf("blkfile is in -blk.format=%s not %s", e.got, e.want)
+}
+
+// checkFormat - returns a *formatErr unless blkfile 'data' may be in
+// -blk.format 'name', so a file is never scanned (and truncated) per the wrong format.
+func checkFormat(data []byte, name string) error {
+	if got := formatOf(data); got != "" && got != name {
+		return &formatErr{got, name}
+	}
+	return nil
+}
+
+// jsonFormat - blkfile is a single json object with a member per invocation
+// ("invts-<epoch>") holding an array of its blocks. Closing "]}" is written at
+// exit and the next invocation replaces the final '}' to add its member.
+type jsonFormat struct{}
+
+func (jsonFormat) appendBlk(f *os.File, inv string, first bool, bdata []byte) (int64, int, error) {
+	var buf bytes.Buffer
+	if first {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, 0, err
+		}
+		size := fi.Size()
+		if size == 0 {
+			buf.WriteString("{")
+		} else {
+			// need to replace last char which must be '}' (see fileStore.recover) in file with a ',' and add linefeed.
+			last := make([]byte, 1)
+			if _, err = f.ReadAt(last, size-1); err != nil {
+				return 0, 0, err
+			}
+			if last[0] != '}' {
+				return 0, 0, fmt.Errorf("blkfile last char is %q not '}'", last[0])
+			}
+			if _, err = f.Seek(size-1, io.SeekStart); err != nil {
+				return 0, 0, err
+			}
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(`"` + inv + `":[`)
+	} else {
+		buf.WriteString(",\n")
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	off := pos + int64(buf.Len())
+	buf.Write(bdata)
+	n, err := f.Write(buf.Bytes())
+	return off, n, err
+}
+
+func (jsonFormat) ext() string {
+	return ".json"
+}
+
+func (jsonFormat) closeInv(f *os.File) (int, error) {
+	return f.Write([]byte("]}"))
+}
+
+func (jsonFormat) decode(data []byte, open bool) (blkchainDoc, error) {
+	var doc blkchainDoc
+	if len(data) == 0 {
+		return doc, nil
+	}
+	// closing json syntax is only written at exit, so supply it if the
+	// invocation is still open.
+	if open {
+		data = append(data, "]}"...)
+	}
+	err := json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func (jsonFormat) scan(data []byte, open bool, fn func(inv string, b *Blk, off, end int64) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// token - returns the next token which must be 'want' if set; at EOF
+	// io.EOF if open (the closing json syntax is only written at exit).
+	token := func(want json.Delim) (json.Token, error) {
+		tok, err := dec.Token()
+		if err != nil && truncated(err, data) {
+			err = io.EOF
+		}
+		if err == io.EOF && !open {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil && want != 0 && tok != want {
+			err = fmt.Errorf("blkfile: expected %v got %v", want, tok)
+		}
+		return tok, err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	// more - dec.More is true at EOF, so also check there is more data.
+	more := func() bool {
+		return len(bytes.TrimSpace(data[dec.InputOffset():])) > 0 && dec.More()
+	}
+	if _, err := token('{'); err != nil {
+		return err
+	}
+	for more() {
+		tok, err := token(0)
+		if err != nil {
+			return err
+		}
+		inv, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("blkfile: expected invocation name got %v", tok)
+		}
+		if _, err = token('['); err != nil {
+			return err
+		}
+		for more() {
+			start := dec.InputOffset()
+			var b Blk
+			if err = dec.Decode(&b); err != nil {
+				return err
+			}
+			end := dec.InputOffset()
+			// start is before the ',' separating b from the block before it.
+			off := end - int64(len(bytes.TrimLeft(data[start:end], ", \t\r\n")))
+			if err = fn(inv, &b, off, end); err != nil {
+				return err
+			}
+		}
+		if _, err = token(']'); err != nil {
+			return ignoreEOF(err)
+		}
+	}
+	_, err := token('}')
+	return ignoreEOF(err)
+}
+
+// truncated - returns true if err is json decoding of 'data' running out of
+// data, json.Decoder reports some cases as a *json.SyntaxError at its end.
+func truncated(err error, data []byte) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	se, ok := err.(*json.SyntaxError)
+	return ok && se.Offset >= int64(len(data))
+}
+
+// ignoreEOF - returns err unless it is io.EOF.
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (jsonFormat) goodLen(data []byte) (good int64, closing string, complete bool, err error) {
+	if err = checkFormat(data, "json"); err != nil {
+		return 0, "", false, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// stop - ends the scan at what follows the last complete block (or
+	// invocation group): only a partially written final record running to EOF
+	// may follow it, anything else is corruption.
+	stop := func(err error) (int64, string, bool, error) {
+		if truncated(err, data) && tornTail(data[good:]) {
+			return good, closing, false, nil
+		}
+		return good, "", false, &corruptErr{good, err}
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return stop(err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return 0, "", false, fmt.Errorf("blkfile: expected '{' got %v", tok)
+	}
+
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return stop(err)
+		}
+		if _, ok := tok.(string); !ok {
+			return stop(fmt.Errorf("expected invocation name got %v", tok))
+		}
+		if tok, err = dec.Token(); err != nil {
+			return stop(err)
+		}
+		if tok != json.Delim('[') {
+			return stop(fmt.Errorf("expected '[' got %v", tok))
+		}
+		for dec.More() {
+			var b Blk
+			if err = dec.Decode(&b); err != nil {
+				return stop(err)
+			}
+			good, closing = dec.InputOffset(), "]}"
+		}
+		if tok, err = dec.Token(); err != nil {
+			return stop(err)
+		}
+		if tok != json.Delim(']') {
+			return stop(fmt.Errorf("expected ']' got %v", tok))
+		}
+		good, closing = dec.InputOffset(), "}"
+	}
+	if tok, err = dec.Token(); err != nil {
+		return stop(err)
+	}
+	if tok != json.Delim('}') {
+		return stop(fmt.Errorf("expected '}' got %v", tok))
+	}
+	good, closing = dec.InputOffset(), ""
+	if len(bytes.TrimSpace(data[good:])) != 0 {
+		return stop(fmt.Errorf("data after closing '}'"))
+	}
+	return good, closing, true, nil
+}
+
+// tornTail - returns true if 'rest', what follows the last complete block of
+// a blkfile, can only be a partially written final record: every record is
+// appended by a single write starting with at most one line feed, after its
+// ',' separator, and block json has none.
+func tornTail(rest []byte) bool {
+	return bytes.LastIndexByte(bytes.TrimRight(rest, " \t\r\n"), '\n') <= 1
+}
+
+// corruptErr - blkfile data that is not a partially written final record,
+// i.e. it was corrupted and can not be repaired by truncating it.
+type corruptErr struct {
+	good int64 // length of the leading part ending on a complete block.
+	err  error
+}
+
+func (e *corruptErr) Error() string {
+	return fmt.Sprintf("blkfile: corrupt after offset %d (last complete block): %v", e.good, e.err)
+}
+
+// jsonlFormat - blkfile is newline delimited json: a header record
+// {"invocation":"invts-<epoch>"} starts each invocation followed by one block
+// per line, so blocks are plainly appended and the file can be tailed.
+type jsonlFormat struct{}
+
+// jsonlHdr - invocation header record of a jsonl blkfile.
+type jsonlHdr struct {
+	Invocation string `json:"invocation"`
+}
+
+// jsonlRec - a line of a jsonl blkfile, an invocation header or a block.
+type jsonlRec struct {
+	jsonlHdr
+	Blk
+}
+
+func (jsonlFormat) appendBlk(f *os.File, inv string, first bool, bdata []byte) (int64, int, error) {
+	var buf bytes.Buffer
+	if first {
+		hdr, err := json.Marshal(jsonlHdr{inv})
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err = f.Seek(0, io.SeekEnd); err != nil {
+			return 0, 0, err
+		}
+		buf.Write(hdr)
+		buf.WriteString("\n")
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	off := pos + int64(buf.Len())
+	buf.Write(bdata)
+	buf.WriteString("\n")
+	n, err := f.Write(buf.Bytes())
+	return off, n, err
+}
+
+func (jsonlFormat) ext() string {
+	return ".jsonl"
+}
+
+func (jsonlFormat) closeInv(f *os.File) (int, error) {
+	return 0, nil
+}
+
+// decodeLine - decodes one jsonl record appending it to doc.
+func (jsonlFormat) decodeLine(line []byte, doc *blkchainDoc) error {
+	var rec jsonlRec
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return err
+	}
+	if rec.Invocation != "" {
+		*doc = append(*doc, invGroup{Name: rec.Invocation})
+		return nil
+	}
+	if rec.BlockHash == "" {
+		return fmt.Errorf("blkfile: record is neither an invocation header nor a block")
+	}
+	if len(*doc) == 0 {
+		return fmt.Errorf("blkfile: block before any invocation header")
+	}
+	g := &(*doc)[len(*doc)-1]
+	g.Blocks = append(g.Blocks, rec.Blk)
+	return nil
+}
+
+func (jsonlFormat) scan(data []byte, open bool, fn func(inv string, b *Blk, off, end int64) error) error {
+	var inv string
+	for off, n := 0, 1; off < len(data); n++ {
+		i := bytes.IndexByte(data[off:], '\n')
+		if i < 0 {
+			i = len(data) - off
+		}
+		line := data[off : off+i]
+		if len(bytes.TrimSpace(line)) != 0 {
+			var rec jsonlRec
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+			switch {
+			case rec.Invocation != "":
+				inv = rec.Invocation
+			case rec.BlockHash == "":
+				return fmt.Errorf("line %d: blkfile: record is neither an invocation header nor a block", n)
+			case inv == "":
+				return fmt.Errorf("line %d: blkfile: block before any invocation header", n)
+			default:
+				if err := fn(inv, &rec.Blk, int64(off), int64(off+i)); err != nil {
+					return err
+				}
+			}
+		}
+		off += i + 1
+	}
+	return nil
+}
+
+func (f jsonlFormat) decode(data []byte, open bool) (blkchainDoc, error) {
+	var doc blkchainDoc
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		if err := f.decodeLine(sc.Bytes(), &doc); err != nil {
+			return doc, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return doc, sc.Err()
+}
+
+func (f jsonlFormat) goodLen(data []byte) (good int64, closing string, complete bool, err error) {
+	if err = checkFormat(data, "jsonl"); err != nil {
+		return 0, "", false, err
+	}
+	var doc blkchainDoc
+	for off, n := 0, 1; off < len(data); n++ {
+		i := bytes.IndexByte(data[off:], '\n')
+		if i < 0 {
+			break // partially written last line.
+		}
+		line := data[off : off+i]
+		off += i + 1
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		// a complete line is never torn, so one that does not decode is corruption.
+		if err = f.decodeLine(line, &doc); err != nil {
+			return good, "", false, &corruptErr{good, fmt.Errorf("line %d: %v", n, err)}
+		}
+		// a trailing header without any block is not kept.
+		if g := doc[len(doc)-1]; len(g.Blocks) > 0 {
+			good = int64(off)
+		}
+	}
+	return good, "", good == int64(len(data)), nil
+}
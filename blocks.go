@@ -0,0 +1,99 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to retrieving committed blocks (/blocks).
+
+// /blocks page size limits.
+const (
+	blksLimitDef = 20
+	blksLimitMax = 100
+)
+
+// blksPage - a page of committed blocks in height order.
+type blksPage struct {
+	Total  uint64   `json:"total"` // number of committed blocks.
+	From   uint64   `json:"from"`
+	Blocks []blkLoc `json:"blocks"`
+	Next   *uint64  `json:"next,omitempty"` // 'from' of the next page, if any.
+}
+
+// cepBlocks - client entry point for: /blocks[?from=height&limit=n].
+func cepBlocks(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	var from uint64
+	limit := blksLimitDef
+	var err error
+	if s := r.FormValue("from"); s != "" {
+		if from, err = strconv.ParseUint(s, 10, 64); err != nil {
+			sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: from must be a block height; from=%q", s))
+			return
+		}
+	}
+	if s := r.FormValue("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > blksLimitMax {
+			sendClientError(w, http.StatusBadRequest,
+				fmt.Sprintf("Error: limit must be 1 to %d; limit=%q", blksLimitMax, s))
+			return
+		}
+	}
+
+	page := &blksPage{From: from}
+	page.Blocks, page.Total = lookupHeights(from, limit)
+	if next := from + uint64(len(page.Blocks)); len(page.Blocks) > 0 && next < page.Total {
+		page.Next = &next
+	}
+	sendJSON(w, http.StatusOK, page, verblvl > 2)
+}
+
+// cepBlockHead - client entry point for: /blocks/head, the last committed block.
+func cepBlockHead(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	n := chainLen()
+	if n == 0 {
+		sendClientError(w, http.StatusNotFound, "Error: no committed blocks")
+		return
+	}
+	b, _ := lookupHeight(n - 1)
+	sendJSON(w, http.StatusOK, b, verblvl > 2)
+}
+
+// cepBlockHeight - client entry point for: /blocks/height/{n}.
+func cepBlockHeight(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	s := mux.Vars(r)["n"]
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: invalid block height %q", s))
+		return
+	}
+	b, ok := lookupHeight(n)
+	if !ok {
+		sendClientError(w, http.StatusNotFound, fmt.Sprintf("Error: no committed block at height %d", n))
+		return
+	}
+	sendJSON(w, http.StatusOK, b, verblvl > 2)
+}
+
+// cepBlockHash - client entry point for: /blocks/{hash}.
+func cepBlockHash(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	hash := mux.Vars(r)["hash"]
+	b, ok := lookupBlkLoc(hash)
+	if !ok {
+		sendClientError(w, http.StatusNotFound, fmt.Sprintf("Error: no committed block with hash %q", hash))
+		return
+	}
+	sendJSON(w, http.StatusOK, b, verblvl > 2)
+}
@@ -20,16 +20,27 @@ import (
 type flagsStruct struct {
 	blkctimestr    blkCtimeStr // used as special hook to validate time specified meets min duration.
 	blktxmax       int
+	clockfake      string
 	blkfile        string
+	blkformat      string
+	blksegdir      string
+	blksegmaxbytes int64
+	blkstore       string
 	devmode        bool
 	expvars        bool
 	fnlogflags     int
 	showinvdetails bool
 	showversion    bool
+	srvadminenable bool
 	srvport        int
 	srvsdenable    bool
 	srvurl         string
+	txdupmode      string
+	txhashver      int
+	txownership    bool
+	txrequiresig   bool
 	verblvl        int
+	verify         string
 }
 
 // these constants might belong in tx.go TBD
@@ -75,16 +86,27 @@ func init() {
 	flag2.Var(flags.blkctimestr, "blk.ctime", "block commit time duration")
 
 	flag2.StringVar(&flags.blkfile, "blk.file", "blkchain.json", "name of blockchain json file")
+	flag2.StringVar(&flags.blkformat, "blk.format", "json", "blockchain file format: json (single object) or jsonl (a block per line); -verify goes by the file's own")
+	flag2.StringVar(&flags.blksegdir, "blk.segdir", "blkchain-segs", "directory of segment files for -blk.store=seg")
+	flag2.Int64Var(&flags.blksegmaxbytes, "blk.segmaxbytes", 0, "<1 =off, >0 =rotate to a new segment file once current reaches this size")
+	flag2.StringVar(&flags.blkstore, "blk.store", "file", "block store: file (blk.file), seg (blk.segdir) or mem (memory only)")
 	flag2.IntVar(&flags.blktxmax, "blk.txmax", 0, "<1 =off, >0 =max transactions in a block")
+	flag2.StringVar(&flags.clockfake, "clock.fake", "", "use a fake clock starting at this RFC3339 time, advanced only via /clock/advance")
 	flag2.BoolVar(&flags.devmode, "devmode", false, "development mode")
 	flag2.BoolVar(&flags.expvars, "expvars", false, "expose expvars (via /debug/vars)")
 	flag2.IntVar(&flags.fnlogflags, "fnlogflags", fn.LflagsDef, "see fn.LogSetFlags")
 	flag2.BoolVar(&flags.showinvdetails, "invdetails", false, "show invocation details")
 	flag2.BoolVar(&flags.showversion, "version", false, "show version and exit")
 	flag2.IntVar(&flags.srvport, "srv.port", 8080, "server port to listen on")
+	flag2.BoolVar(&flags.srvadminenable, "srv.adminenable", false, "enables admin http apis /admin/commit, /admin/pause and /admin/resume")
 	flag2.BoolVar(&flags.srvsdenable, "srv.sdenable", false, "enables srv shutdown http api /srvshutdown")
 	flag2.StringVar(&flags.srvurl, "srv.url", "localhost", "server url")
+	flag2.StringVar(&flags.txdupmode, "tx.dupmode", dupModeReject, "duplicate tx (same ID as pending or committed tx): reject (409) or nonce (set nonce to make ID unique, needs -tx.hashver=1)")
+	flag2.IntVar(&flags.txhashver, "tx.hashver", hashVerCanon, "tx ID hash version: 1 =canonical, 0 =legacy (ambiguous)")
+	flag2.BoolVar(&flags.txownership, "tx.ownership", false, "writes to a key owned (first signed by) a pubkey must be signed by it or its delegates")
+	flag2.BoolVar(&flags.txrequiresig, "tx.requiresig", false, "reject transactions not signed (ed25519 pubkey and sig)")
 	flag2.IntVar(&flags.verblvl, "verblvl", 0, "verbosity level")
+	flag2.StringVar(&flags.verify, "verify", "", "verify given blkchain json file and exit")
 }
 
 func osExit(excode int) {
@@ -95,6 +117,36 @@ func osExit(excode int) {
 	os.Exit(excode)
 }
 
+// checkFlags - exits if flags values are invalid or conflict.
+func checkFlags() {
+	if _, ok := blkFormats[flags.blkformat]; !ok {
+		fmt.Fprintf(os.Stderr, "invalid -blk.format=%q; must be json or jsonl\n", flags.blkformat)
+		osExit(ExcodeCliFlagissue)
+	}
+	if flags.txhashver != hashVerLegacy && flags.txhashver != hashVerCanon {
+		fmt.Fprintf(os.Stderr, "invalid -tx.hashver=%d; must be %d or %d\n", flags.txhashver, hashVerLegacy, hashVerCanon)
+		osExit(ExcodeCliFlagissue)
+	}
+	if flags.txdupmode != dupModeReject && flags.txdupmode != dupModeNonce {
+		fmt.Fprintf(os.Stderr, "invalid -tx.dupmode=%q; must be %s or %s\n", flags.txdupmode, dupModeReject, dupModeNonce)
+		osExit(ExcodeCliFlagissue)
+	}
+	if flags.txdupmode == dupModeNonce && flags.txhashver == hashVerLegacy {
+		fmt.Fprintf(os.Stderr, "-tx.dupmode=%s needs -tx.hashver=%d\n", dupModeNonce, hashVerCanon)
+		osExit(ExcodeCliFlagissue)
+	}
+	if _, ok := blkStores[flags.blkstore]; !ok {
+		fmt.Fprintf(os.Stderr, "invalid -blk.store=%q; must be file, seg or mem\n", flags.blkstore)
+		osExit(ExcodeCliFlagissue)
+	}
+	if flags.clockfake != "" {
+		if _, err := time.Parse(time.RFC3339Nano, flags.clockfake); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -clock.fake=%q; err=%v\n", flags.clockfake, err)
+			osExit(ExcodeCliFlagissue)
+		}
+	}
+}
+
 func prelimsCLI(gotest bool) {
 	flag2.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s: (Version:%s)\n", os.Args[0], Version)
@@ -116,6 +168,14 @@ func prelimsCLI(gotest bool) {
 	}
 
 	fn.LogSetFlags(flags.fnlogflags)
+	checkFlags()
+
+	// set clock and capture time of invocation.
+	if flags.clockfake != "" {
+		start, _ := time.Parse(time.RFC3339Nano, flags.clockfake)
+		clk = newFakeClock(start)
+	}
+	timeofinv = clk.Now()
 
 	if flags.showversion {
 		fn.LogCondMsg(true, fmt.Sprintf("%s version=%s\n", os.Args[0], Version))
@@ -136,12 +196,22 @@ func prelimsCLI(gotest bool) {
 	blkctime, _ = time.ParseDuration(string(flags.blkctimestr))
 	blkctimestr = string(flags.blkctimestr)
 	blkfile = flags.blkfile
+	blkfmt = blkFormats[flags.blkformat]
+	blksegdir = flags.blksegdir
+	blksegmaxbytes = flags.blksegmaxbytes
+	blkstorename = flags.blkstore
 	blktxmax = flags.blktxmax
 	devMode = flags.devmode
 	expvars = flags.expvars
 	fnlogflags = flags.fnlogflags
 	srvport = flags.srvport
+	srvadminenable = flags.srvadminenable
 	srvsdenable = flags.srvsdenable
 	srvurl = flags.srvurl
+	txdupmode = flags.txdupmode
+	txhashver = flags.txhashver
+	txownership = flags.txownership
+	txrequiresig = flags.txrequiresig
 	verblvl = flags.verblvl
+	verifyfile = flags.verify
 }
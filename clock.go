@@ -0,0 +1,138 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains the clock used for tx timestamps, the block commit
+// timer and the invocation time; a fakeClock (-clock.fake) makes them
+// deterministic for tests and simulations.
+
+// blkClock - source of time.
+type blkClock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) blkTimer
+}
+
+// blkTimer - a timer made by blkClock.AfterFunc.
+type blkTimer interface {
+	Stop() bool
+}
+
+// clk - the clock in use.
+var clk blkClock = realClock{}
+
+// realClock - the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) blkTimer {
+	return time.AfterFunc(d, f)
+}
+
+// fakeClock - a clock whose time only moves via Advance, which also runs
+// the timers that became due.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c    *fakeClock
+	when time.Time
+	f    func()
+}
+
+func newFakeClock(start time.Time) *fakeClock {
+	return &fakeClock{now: start}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) blkTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Stop - returns true if the timer was stopped before it ran.
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	for i, ct := range t.c.timers {
+		if ct == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance - moves the clock forward by d, running the timers that become due
+// in order of when they are due, each with the clock at its due time as a
+// real timer would; a timer a timer func sets is run too if due by then.
+func (c *fakeClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		next := -1
+		for i, t := range c.timers {
+			if !t.when.After(end) && (next < 0 || t.when.Before(c.timers[next].when)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		// run outside of c.mu since a timer func may use the clock.
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+	return end
+}
+
+// cepClockAdvance - client entry point for: /clock/advance?d=duration (with -clock.fake).
+func cepClockAdvance(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	fc, ok := clk.(*fakeClock)
+	if !ok {
+		sendClientError(w, http.StatusConflict, "Error: clock is not fake (see -clock.fake)")
+		return
+	}
+	d, err := time.ParseDuration(r.FormValue("d"))
+	if err != nil || d < 0 {
+		sendClientError(w, http.StatusBadRequest, "Error: d must be a non negative duration e.g. d=1m30s")
+		return
+	}
+	now := fc.Advance(d)
+	sendJSON(w, http.StatusOK, struct {
+		Now   time.Time `json:"now"`
+		NowNs int64     `json:"nowns"`
+	}{now, now.UnixNano()}, verblvl > 2)
+}
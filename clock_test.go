@@ -0,0 +1,132 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// commitStep - an operation of TestCommitTiming and the committed blocks and
+// pending transactions expected after it.
+type commitStep struct {
+	op      string // tx, advance (by d), pause or resume.
+	d       time.Duration
+	blocks  uint64
+	pending int
+}
+
+func TestCommitTiming(t *testing.T) {
+	const m = time.Minute
+	tests := []struct {
+		name  string
+		txmax int
+		steps []commitStep
+		times []time.Duration // block commit times since testStart.
+	}{
+		{"commit time", 0, []commitStep{
+			{"tx", 0, 0, 1},
+			{"advance", m - time.Second, 0, 1},
+			{"advance", time.Second, 1, 0},
+			{"advance", 5 * m, 1, 0}, // no empty blocks.
+			{"tx", 0, 1, 1},
+			{"advance", 30 * time.Second, 1, 1},
+			{"tx", 0, 1, 2},
+			{"advance", 29 * time.Second, 1, 2},
+			{"advance", time.Second, 2, 0},
+		}, []time.Duration{m, 7 * m}},
+		{"max txs", 2, []commitStep{
+			{"tx", 0, 0, 1},
+			{"tx", 0, 1, 0},
+			{"advance", 5 * m, 1, 0}, // its timer was stopped.
+			{"tx", 0, 1, 1},
+			{"advance", m, 2, 0},
+		}, []time.Duration{0, 6 * m}},
+		{"one tx per block", 1, []commitStep{
+			{"tx", 0, 1, 0},
+			{"tx", 0, 2, 0},
+			{"advance", 5 * m, 2, 0},
+		}, []time.Duration{0, 0}},
+		{"paused", 2, []commitStep{
+			{"pause", 0, 0, 0},
+			{"tx", 0, 0, 1},
+			{"tx", 0, 0, 2},
+			{"tx", 0, 0, 3},
+			{"advance", 5 * m, 0, 3},
+			{"resume", 0, 1, 1},
+			{"advance", m - time.Second, 1, 1},
+			{"advance", time.Second, 2, 0},
+		}, []time.Duration{5 * m, 6 * m}},
+	}
+
+	for _, tc := range tests {
+		fc := newTestChain(t)
+		blktxmax = tc.txmax
+		for i, st := range tc.steps {
+			switch st.op {
+			case "tx":
+				mustAddTx(t, "k", fmt.Sprintf("v%d", i))
+			case "advance":
+				fc.Advance(st.d)
+			default:
+				adminDo(st.op)
+			}
+			bcmu.Lock()
+			pending := len(blk.Transactions)
+			bcmu.Unlock()
+			if n := chainLen(); n != st.blocks || pending != st.pending {
+				t.Errorf("%s step %d %s: blocks:%d pending:%d want %d %d", tc.name, i, st.op,
+					n, pending, st.blocks, st.pending)
+			}
+		}
+
+		var times []time.Duration
+		for _, g := range testDoc(t) {
+			for _, b := range g.Blocks {
+				times = append(times, time.Duration(b.TimeStampNs-testStart.UnixNano()))
+			}
+		}
+		if fmt.Sprint(times) != fmt.Sprint(tc.times) {
+			t.Errorf("%s: block commit times %v want %v", tc.name, times, tc.times)
+		}
+	}
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	fc := newFakeClock(testStart)
+	var ran []string
+	// timer - returns a timer func recording 'name' and the clock when run.
+	timer := func(name string) func() {
+		return func() { ran = append(ran, fmt.Sprintf("%s@%v", name, fc.Now().Sub(testStart))) }
+	}
+	fc.AfterFunc(2*time.Second, timer("b"))
+	fc.AfterFunc(time.Second, func() {
+		timer("a")()
+		fc.AfterFunc(500*time.Millisecond, timer("a2")) // set by a timer, due before b.
+	})
+	stopped := fc.AfterFunc(time.Second, timer("stopped"))
+	if !stopped.Stop() {
+		t.Errorf("Stop of a pending timer returned false")
+	}
+
+	tests := []struct {
+		advance time.Duration
+		ran     string
+	}{
+		{999 * time.Millisecond, "[]"},
+		{5 * time.Second, "[a@1s a2@1.5s b@2s]"},
+		{time.Hour, "[a@1s a2@1.5s b@2s]"},
+	}
+	for _, tc := range tests {
+		fc.Advance(tc.advance)
+		if got := fmt.Sprint(ran); got != tc.ran {
+			t.Errorf("after %v: ran %s want %s", tc.advance, got, tc.ran)
+		}
+	}
+	if stopped.Stop() {
+		t.Errorf("Stop of a stopped timer returned true")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// this file contains functions related to duplicate transactions (-tx.dupmode),
+// e.g. identical key and value submitted twice within the same second.
+
+// -tx.dupmode values.
+const (
+	dupModeReject = "reject" // reject a duplicate with 409.
+	dupModeNonce  = "nonce"  // make the ID unique by setting the tx's Nonce.
+)
+
+// txnonce - last nonce given to a duplicate tx; guarded by bcmu.
+var txnonce uint64
+
+// isDupll - returns true if a tx with ID 'id' is pending in blk, in 'batch'
+// (may be nil) or is committed; expects bcmu.Lock mutex to be active.
+func isDupll(id string, batch *batchSeen) bool {
+	if batch != nil && batch.ids[id] {
+		return true
+	}
+	for i := range blk.Transactions {
+		if blk.Transactions[i].ID == id {
+			return true
+		}
+	}
+	return isCommitted(id)
+}
+
+// checkDup - handles tx having the ID of a pending, batch or committed tx
+// according to -tx.dupmode; expects bcmu.Lock mutex to be active.
+func checkDup(tx *txStruct, batch *batchSeen) *txErr {
+	for isDupll(tx.ID, batch) {
+		if txdupmode != dupModeNonce {
+			return &txErr{http.StatusConflict, ErrTxDuplicate,
+				fmt.Sprintf("duplicate of tx id=%q", tx.ID)}
+		}
+		txnonce++
+		tx.Nonce = txnonce
+		tx.ID = tx.computeID()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// dupStep - a tx of 'value' for key k submitted by TestDuplicates.
+type dupStep struct {
+	name    string
+	value   string
+	advance time.Duration // clock advance first.
+	commit  bool          // commit the pending block first.
+	want    int           // error code, 0 if added.
+	nonce   uint64        // of the added tx.
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		mode  string
+		steps []dupStep
+	}{
+		{dupModeReject, []dupStep{
+			{"first", "v", 0, false, 0, 0},
+			{"pending duplicate", "v", 0, false, ErrTxDuplicate, 0},
+			{"other value", "w", 0, false, 0, 0},
+			{"committed duplicate", "v", 0, true, ErrTxDuplicate, 0},
+			{"same value later", "v", time.Nanosecond, false, 0, 0},
+		}},
+		{dupModeNonce, []dupStep{
+			{"first", "v", 0, false, 0, 0},
+			{"pending duplicate", "v", 0, false, 0, 1},
+			{"pending duplicate again", "v", 0, false, 0, 2},
+			{"committed duplicate", "v", 0, true, 0, 3},
+			{"same value later", "v", time.Nanosecond, false, 0, 0},
+		}},
+	}
+
+	for _, tc := range tests {
+		fc := newTestChain(t)
+		txdupmode = tc.mode
+		ids := make(map[string]bool)
+		for _, st := range tc.steps {
+			fc.Advance(st.advance)
+			if st.commit {
+				blk.flush()
+			}
+			tx, terr := addTestTx(t, txReq{Key: "k", Value: st.value})
+			switch {
+			case terr == nil && st.want != 0:
+				t.Errorf("%s %s: added want err %d", tc.mode, st.name, st.want)
+			case terr != nil && terr.code != st.want:
+				t.Errorf("%s %s: err %d %s want %d", tc.mode, st.name, terr.code, terr.msg, st.want)
+			case terr == nil:
+				if tx.Nonce != st.nonce {
+					t.Errorf("%s %s: nonce %d want %d", tc.mode, st.name, tx.Nonce, st.nonce)
+				}
+				if ids[tx.ID] {
+					t.Errorf("%s %s: ID %s added twice", tc.mode, st.name, tx.ID)
+				}
+				ids[tx.ID] = true
+			}
+		}
+		blk.flush()
+		if _, verr := verifyChain(testDoc(t)); verr != nil {
+			t.Errorf("%s: verify err:%v", tc.mode, verr)
+		}
+	}
+}
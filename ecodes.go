@@ -18,7 +18,11 @@ const (
 	ExcodeHTTPServerErr        = 3   //
 	ExcodeCtrlcSignal          = 4   // control-c, or process was ended via bash> kill pid or similar
 	ExcodeFileOpenErr          = 5   //
-	ExcodeSystemMonitorKill    = 137 // seen using xubuntu 'system monitor' kill, json file likely will have issues AVOID!
+	ExcodeFileDecodeErr        = 6   //
+	ExcodeVerifyCorrupt        = 7   // -verify: file is not a complete blkchain json file
+	ExcodeVerifyTampered       = 8   // -verify: a tx ID, block hash or prev hash does not match
+	ExcodeVerifySegment        = 9   // -verify: file is a segment after the first, verify its manifest
+	ExcodeSystemMonitorKill    = 137 // seen using xubuntu 'system monitor' kill, json file is repaired on next run see fileStore.recover
 	ExcodeCliHelpUsage         = 200 //
 	ExcodeCliFlagissue         = 201 //
 	ExcodeCliUnrecognizedInput = 202 //
@@ -32,6 +36,10 @@ var excodeText = map[int]string{
 	ExcodeHTTPServerErr:        "HTTP server error",
 	ExcodeCtrlcSignal:          "control-c or similar caused exit",
 	ExcodeFileOpenErr:          "file open error",
+	ExcodeFileDecodeErr:        "file decode error",
+	ExcodeVerifyCorrupt:        "verify found file corrupt",
+	ExcodeVerifyTampered:       "verify found file tampered",
+	ExcodeVerifySegment:        "verify refused a segment after the first",
 	ExcodeCliHelpUsage:         "CLI help usage was requested",
 	ExcodeCliFlagissue:         "CLI flag issue",
 	ExcodeCliUnrecognizedInput: "CLI unrecognized input",
@@ -56,6 +64,18 @@ const (
 	ErrJSONunMarshal     = 102
 	ErrJSONdecodeBody    = 103
 	ErrJSONdecodeFile    = 104
+	ErrMerkleProof       = 105
+	ErrTxSigMissing      = 106
+	ErrTxSigMalformed    = 107
+	ErrTxSigInvalid      = 108
+	ErrTxNotOwner        = 109
+	ErrTxDuplicate       = 110
+	ErrTxKeyValue        = 111
+	ErrTxBatchAborted    = 112
+	ErrTxNotFound        = 113
+	ErrKeyNotFound       = 114
+	ErrEventStream       = 115
+	ErrTxPrevID          = 116
 )
 
 var errText = map[int]string{
@@ -64,6 +84,18 @@ var errText = map[int]string{
 	ErrJSONunMarshal:     "error json.Unmarshal",
 	ErrJSONdecodeBody:    "error json.decodeBody",
 	ErrJSONdecodeFile:    "error json.decodeFile",
+	ErrMerkleProof:       "error merkle proof",
+	ErrTxSigMissing:      "error tx signature missing",
+	ErrTxSigMalformed:    "error tx pubkey or signature malformed",
+	ErrTxSigInvalid:      "error tx signature invalid",
+	ErrTxNotOwner:        "error tx not signed by key owner or delegate",
+	ErrTxDuplicate:       "error tx duplicate",
+	ErrTxKeyValue:        "error tx key or value not set",
+	ErrTxBatchAborted:    "error tx not added, atomic batch had a rejected tx",
+	ErrTxNotFound:        "error tx not found",
+	ErrKeyNotFound:       "error key not found",
+	ErrEventStream:       "error event stream",
+	ErrTxPrevID:          "error tx previd is not the ID of its key's last tx",
 }
 
 // ErrText - returns error text for given 'code'
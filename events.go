@@ -0,0 +1,133 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains the server-sent events stream of committed blocks (/events).
+// A subscriber is only woken up when a block is committed, it then reads the
+// blocks it has not sent yet from the index; so committing never waits for a
+// slow subscriber and a subscriber can not miss blocks.
+
+// eventsKeepalive - how often an idle stream gets a comment to keep it open.
+const eventsKeepalive = 30 * time.Second
+
+var (
+	submu      sync.Mutex                     // subscribers mutex
+	subs       = make(map[chan struct{}]bool) // wake up channels of the /events subscribers.
+	eventsDone = make(chan struct{})          // closed at server shutdown to end the streams and commit waits.
+	eventsOnce sync.Once
+)
+
+// subscribe - returns a new subscriber's wake up channel.
+func subscribe() chan struct{} {
+	submu.Lock()
+	defer submu.Unlock()
+
+	wake := make(chan struct{}, 1)
+	subs[wake] = true
+	return wake
+}
+
+func unsubscribe(wake chan struct{}) {
+	submu.Lock()
+	defer submu.Unlock()
+
+	delete(subs, wake)
+}
+
+// notifyBlk - wakes up the subscribers after a block is committed, without
+// blocking: a subscriber already due to wake up is not signalled again.
+func notifyBlk() {
+	submu.Lock()
+	defer submu.Unlock()
+
+	for wake := range subs {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// endEvents - ends the /events streams and /tx commit waits so server.Shutdown
+// does not wait on them.
+func endEvents() {
+	eventsOnce.Do(func() { close(eventsDone) })
+}
+
+// cepEvents - client entry point for: /events, a text/event-stream of the
+// committed blocks (event block, id height) from the next one committed or,
+// if reconnecting with header Last-Event-ID, from the one after it.
+func cepEvents(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	if _, ok := w.(http.Flusher); !ok {
+		sendHTTPError(w, http.StatusInternalServerError, ErrEventStream,
+			"response writer does not support flushing", callerPar())
+		return
+	}
+
+	wake := subscribe()
+	defer unsubscribe(wake)
+	next := chainLen()
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		last, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: Last-Event-ID must be a block height; Last-Event-ID=%q", s))
+			return
+		}
+		if last < next {
+			next = last + 1
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := writeEventComment(w, "blkchain blocks"); err != nil {
+		return
+	}
+	fn.LogCondMsg(verblvl > 1, fmt.Sprintf("events: subscriber:%s from height:%d\n", r.RemoteAddr, next))
+
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		blks, n := lookupHeights(next, blksLimitMax)
+		for i := range blks {
+			data, err := json.Marshal(&blks[i])
+			if err != nil {
+				logPanic(err)
+			}
+			if err = writeEvent(w, blks[i].Height, "block", data); err != nil {
+				return
+			}
+			next++
+		}
+		if next < n {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-keepalive.C:
+			if err := writeEventComment(w, "keepalive"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-eventsDone:
+			return
+		}
+	}
+}
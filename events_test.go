@@ -0,0 +1,85 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEventsReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID string // Last-Event-ID header, "" for none.
+		scode  int
+		ids    string // ids of the events streamed.
+	}{
+		{"new blocks only", "", http.StatusOK, "[3 4]"},
+		{"replay after 0", "0", http.StatusOK, "[1 2 3 4]"},
+		{"replay after the head", "2", http.StatusOK, "[3 4]"},
+		{"beyond the head", "9", http.StatusOK, "[3 4]"},
+		{"not a height", "x", http.StatusBadRequest, "[]"},
+	}
+
+	r := mux.NewRouter()
+	registerRoutes(r)
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for _, tc := range tests {
+		// 3 blocks committed before the stream opens, 2 after.
+		testBlocks(t, 3, 1)
+		ts := httptest.NewServer(r)
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.lastID != "" {
+			req.Header.Set("Last-Event-ID", tc.lastID)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: err:%v", tc.name, err)
+		}
+		if resp.StatusCode != tc.scode {
+			t.Errorf("%s: status %d want %d", tc.name, resp.StatusCode, tc.scode)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			ts.Close()
+			continue
+		}
+
+		var ids []string
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == ": blkchain blocks":
+				// subscribed, blocks committed from now on are streamed.
+				for i := 0; i < 2; i++ {
+					mustAddTx(t, "k", fmt.Sprintf("new%d", i))
+					blk.flush()
+				}
+			case strings.HasPrefix(line, "id: "):
+				ids = append(ids, strings.TrimPrefix(line, "id: "))
+			}
+			if fmt.Sprint(ids) == tc.ids {
+				break
+			}
+		}
+		_ = resp.Body.Close()
+		ts.Close() // waits for the stream to end before the chain is reset.
+		if got := fmt.Sprint(ids); got != tc.ids {
+			t.Errorf("%s: ids %s want %s (scan err:%v)", tc.name, got, tc.ids, sc.Err())
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains the in-memory index of committed blocks and transactions,
+// it is built from blkstore at startup and kept current by Blk.append2File.
+// Committed transactions are kept in memory, for blocks only where each is in
+// blkstore so a block body is read from blkstore when needed; never while
+// holding idxmu since Blk.append2File waits for it holding bcmu.
+
+// txLoc - location of a committed transaction in the blockchain.
+type txLoc struct {
+	Invocation string   `json:"invocation"`
+	BlockHash  string   `json:"block-hash"`
+	Height     uint64   `json:"height"`   // height of its block.
+	Position   int      `json:"position"` // index of tx in its block's Transactions.
+	Tx         txStruct `json:"transaction"`
+	blkTimeNs  int64    // when its block was committed, 0 if not recorded (legacy).
+}
+
+// blkLoc - a committed block and its invocation group.
+type blkLoc struct {
+	Invocation string `json:"invocation"`
+	Blk
+}
+
+// blkRef - an indexed block: its invocation group, hash and where it is in blkstore.
+type blkRef struct {
+	inv  string
+	hash string
+	pos  blkPos
+}
+
+var (
+	idxmu     sync.RWMutex                // index mutex
+	keyIdx    = make(map[string][]*txLoc) // key to its committed transactions in chain order.
+	txIdx     = make(map[string]*txLoc)   // tx ID to its committed transaction.
+	blkIdx    = make(map[string]uint64)   // block hash to its height.
+	heightIdx []blkRef                    // height to its committed block.
+)
+
+// indexBlk - adds committed block 'b' of invocation group 'inv', at 'pos' in
+// blkstore, to the index. Its height is its position in the chain, a block
+// that has a Height (per its HashVer) must agree.
+func indexBlk(inv string, b *Blk, pos blkPos) error {
+	idxmu.Lock()
+	defer idxmu.Unlock()
+
+	h := uint64(len(heightIdx))
+	if b.HashVer != blkHashVerLegacy && b.Height != h {
+		return fmt.Errorf("index: block:%s height:%d but chain position:%d", b.BlockHash, b.Height, h)
+	}
+	blkIdx[b.BlockHash] = h
+	heightIdx = append(heightIdx, blkRef{inv: inv, hash: b.BlockHash, pos: pos})
+	for i, tx := range b.Transactions {
+		loc := &txLoc{Invocation: inv, BlockHash: b.BlockHash, Height: h, Position: i, Tx: tx,
+			blkTimeNs: b.TimeStampNs}
+		keyIdx[tx.Key] = append(keyIdx[tx.Key], loc)
+		txIdx[tx.ID] = loc
+	}
+	return nil
+}
+
+// buildIndex - builds the index and key ownership from blkstore, to be called
+// before any block is appended during this invocation.
+func buildIndex() error {
+	defer fn.LogCondTrace(verblvl > 1)()
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	invs, blkcnt, badids := 0, 0, 0
+	inv := ""
+	err := blkstore.scanBlks(totblkappSinv > 0, func(name string, b *Blk, pos blkPos) error {
+		if name != inv {
+			inv = name
+			invs++
+		}
+		if err := indexBlk(name, b, pos); err != nil {
+			return err
+		}
+		for j := range b.Transactions {
+			tx := &b.Transactions[j]
+			if tx.computeID() != tx.ID {
+				badids++
+			}
+			applyOwner(tx)
+		}
+		blkcnt++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fn.LogCondMsg(badids > 0, fmt.Sprintf("index: %d txs do not match their ID per their hashver; see -verify\n", badids))
+	fn.LogCondMsg(verblvl > 1, fmt.Sprintf("index built: invocations:%d blocks:%d keys:%d txs:%d owned:%d\n",
+		invs, blkcnt, len(keyIdx), len(txIdx), len(owners)))
+	return nil
+}
+
+// readBlkRef - reads the block at height h per its index entry 'ref' from
+// blkstore; expects idxmu not to be held. A block that can not be read back
+// as indexed means blkstore changed under us.
+func readBlkRef(h uint64, ref blkRef) blkLoc {
+	b, err := blkstore.readBlk(ref.pos)
+	if err != nil {
+		logPanic(fmt.Sprintf("reading block at height:%d err:%v", h, err))
+	}
+	if b.BlockHash != ref.hash {
+		logPanic(fmt.Sprintf("block at height:%d has hash:%s indexed:%s", h, b.BlockHash, ref.hash))
+	}
+	if b.HashVer == blkHashVerLegacy {
+		b.Height = h // legacy blocks do not record it.
+	}
+	return blkLoc{Invocation: ref.inv, Blk: b}
+}
+
+// txLocs - returns copies of 'locs'; expects idxmu to be read locked.
+func txLocs(locs []*txLoc) []txLoc {
+	c := make([]txLoc, 0, len(locs))
+	for _, loc := range locs {
+		c = append(c, *loc)
+	}
+	return c
+}
+
+// lookupKey - returns copies of the committed transactions for 'key'.
+func lookupKey(key string) []txLoc {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	return txLocs(keyIdx[key])
+}
+
+// lookupKeyPage - returns up to 'limit' committed transactions for 'key' kept
+// by filter 'keep', in chain order (reversed if desc), starting at the tx with
+// ID 'cursor' ("" for the first); next is the ID to start the next page at, ""
+// if no more are kept. A tx's chain position does not change as blocks are
+// committed so a cursor stays valid in either order; ok is false if 'cursor'
+// is not a committed tx of 'key'.
+func lookupKeyPage(key, cursor string, limit int, desc bool, keep func(*txLoc) bool) (locs []txLoc, next string, ok bool) {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	all := keyIdx[key]
+	i, step := 0, 1
+	if desc {
+		i, step = len(all)-1, -1
+	}
+	if cursor != "" {
+		c, found := txIdx[cursor]
+		if !found {
+			return nil, "", false
+		}
+		// keyIdx[key] is in chain order, find the cursor by its position.
+		i = sort.Search(len(all), func(j int) bool {
+			return all[j].Height > c.Height || all[j].Height == c.Height && all[j].Position >= c.Position
+		})
+		if i == len(all) || all[i] != c {
+			return nil, "", false
+		}
+	}
+
+	locs = []txLoc{}
+	for ; i >= 0 && i < len(all); i += step {
+		if !keep(all[i]) {
+			continue
+		}
+		if len(locs) == limit {
+			return locs, all[i].Tx.ID, true
+		}
+		locs = append(locs, *all[i])
+	}
+	return locs, "", true
+}
+
+// lookupKeyLast - returns a copy of the last committed transaction for 'key'
+// kept by filter 'keep'.
+func lookupKeyLast(key string, keep func(*txLoc) bool) (txLoc, bool) {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	all := keyIdx[key]
+	for i := len(all) - 1; i >= 0; i-- {
+		if keep(all[i]) {
+			return *all[i], true
+		}
+	}
+	return txLoc{}, false
+}
+
+// lookupKeyLastID - returns the ID of the last committed transaction for 'key'.
+func lookupKeyLastID(key string) (string, bool) {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	all := keyIdx[key]
+	if len(all) == 0 {
+		return "", false
+	}
+	return all[len(all)-1].Tx.ID, true
+}
+
+// isCommitted - returns true if a transaction with ID 'id' is committed.
+func isCommitted(id string) bool {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	_, ok := txIdx[id]
+	return ok
+}
+
+// lookupTx - returns a copy of the committed transaction with tx ID 'id'.
+func lookupTx(id string) (txLoc, bool) {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	loc, ok := txIdx[id]
+	if !ok {
+		return txLoc{}, false
+	}
+	return *loc, true
+}
+
+// lookupBlkLoc - returns the committed block with hash 'hash'.
+func lookupBlkLoc(hash string) (blkLoc, bool) {
+	idxmu.RLock()
+	h, ok := blkIdx[hash]
+	var ref blkRef
+	if ok {
+		ref = heightIdx[h]
+	}
+	idxmu.RUnlock()
+
+	if !ok {
+		return blkLoc{}, false
+	}
+	return readBlkRef(h, ref), true
+}
+
+// lookupHeight - returns the committed block at height 'n'.
+func lookupHeight(n uint64) (blkLoc, bool) {
+	blks, _ := lookupHeights(n, 1)
+	if len(blks) == 0 {
+		return blkLoc{}, false
+	}
+	return blks[0], true
+}
+
+// lookupHeights - returns up to 'limit' committed blocks from height 'from'
+// on, and the chain length.
+func lookupHeights(from uint64, limit int) ([]blkLoc, uint64) {
+	idxmu.RLock()
+	n := uint64(len(heightIdx))
+	var refs []blkRef
+	if from < n {
+		end := n
+		if uint64(limit) < n-from {
+			end = from + uint64(limit)
+		}
+		refs = append(refs, heightIdx[from:end]...)
+	}
+	idxmu.RUnlock()
+
+	blks := make([]blkLoc, 0, len(refs))
+	for i, ref := range refs {
+		blks = append(blks, readBlkRef(from+uint64(i), ref))
+	}
+	return blks, n
+}
+
+// chainLen - returns the number of committed blocks, i.e. the height of the
+// next block.
+func chainLen() uint64 {
+	idxmu.RLock()
+	defer idxmu.RUnlock()
+
+	return uint64(len(heightIdx))
+}
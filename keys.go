@@ -0,0 +1,178 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to reading keys (/keys).
+
+// /keys/{key}/history page size limits.
+const (
+	histLimitDef = 20
+	histLimitMax = 100
+)
+
+// timeNs - returns the tx's time in unix nanoseconds, txs written before
+// TimeStampNs only have seconds.
+func (tx *txStruct) timeNs() int64 {
+	if tx.TimeStampNs != 0 {
+		return tx.TimeStampNs
+	}
+	return tx.TimeStamp * int64(time.Second)
+}
+
+// committedNs - returns when loc's block was committed in unix nanoseconds,
+// legacy blocks do not record it so for them its tx's time.
+func (loc *txLoc) committedNs() int64 {
+	if loc.blkTimeNs != 0 {
+		return loc.blkTimeNs
+	}
+	return loc.Tx.timeNs()
+}
+
+// keyHistPage - a page of the committed transactions for a key.
+type keyHistPage struct {
+	Key   string  `json:"key"`
+	Order string  `json:"order"`
+	Txs   []txLoc `json:"transactions"`
+	Next  string  `json:"next,omitempty"` // cursor of the next page (the ID of its first tx), if any.
+}
+
+// cepKeyHistory - client entry point for:
+// /keys/{key}/history[?order=asc|desc&since=RFC3339&until=RFC3339&limit=n&cursor=next].
+// Lists the key's committed transactions, since is inclusive and until exclusive.
+// The cursor is opaque, it stays valid as blocks are committed.
+func cepKeyHistory(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	page := &keyHistPage{Key: mux.Vars(r)["key"], Order: "asc"}
+	if s := r.FormValue("order"); s != "" {
+		if s != "asc" && s != "desc" {
+			sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: order must be asc or desc; order=%q", s))
+			return
+		}
+		page.Order = s
+	}
+
+	since, until := int64(math.MinInt64), int64(math.MaxInt64)
+	for _, p := range []struct {
+		name string
+		ns   *int64
+	}{{"since", &since}, {"until", &until}} {
+		if s := r.FormValue(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: %s must be an RFC3339 time; %s=%q", p.name, p.name, s))
+				return
+			}
+			*p.ns = t.UnixNano()
+		}
+	}
+
+	var err error
+	limit := histLimitDef
+	if s := r.FormValue("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > histLimitMax {
+			sendClientError(w, http.StatusBadRequest,
+				fmt.Sprintf("Error: limit must be 1 to %d; limit=%q", histLimitMax, s))
+			return
+		}
+	}
+	keep := func(loc *txLoc) bool {
+		ns := loc.Tx.timeNs()
+		return ns >= since && ns < until
+	}
+	cursor := r.FormValue("cursor")
+	var ok bool
+	if page.Txs, page.Next, ok = lookupKeyPage(page.Key, cursor, limit, page.Order == "desc", keep); !ok {
+		sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: invalid cursor %q", cursor))
+		return
+	}
+	sendJSON(w, http.StatusOK, page, verblvl > 2)
+}
+
+// keyValue - the value of a key and the transaction that wrote it.
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	txState
+}
+
+// keyLatest - returns the state of the last transaction for 'key' kept by
+// filter 'keep' if committed or, if pending is true, the last pending one.
+func keyLatest(key string, pending bool, keep func(*txLoc) bool) (*txState, bool) {
+	defer fn.LogCondTrace(verblvl > 2)()
+	// hold bcmu so a block being committed is seen either pending or committed.
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	for i := len(blk.Transactions) - 1; pending && i >= 0; i-- {
+		if blk.Transactions[i].Key == key {
+			return &txState{Status: txStatusPending, Position: i, Tx: blk.Transactions[i]}, true
+		}
+	}
+	loc, ok := lookupKeyLast(key, keep)
+	if !ok {
+		return nil, false
+	}
+	return committedState(loc), true
+}
+
+// cepKey - client entry point for: /keys/{key}[?at=height|RFC3339][?pending=true].
+// The key may contain '/'; one ending in "/history" is routed to cepKeyHistory
+// instead so is read via /searchtx.
+// Returns the key's latest committed value, as of block height or time 'at'
+// (inclusive, of when blocks were committed) if set, or its latest pending
+// value if pending is true.
+func cepKey(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	key := mux.Vars(r)["key"]
+	pending := false
+	if s := r.FormValue("pending"); s != "" {
+		var err error
+		if pending, err = strconv.ParseBool(s); err != nil {
+			sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: pending must be true or false; pending=%q", s))
+			return
+		}
+	}
+
+	keep := func(loc *txLoc) bool { return true }
+	if at := r.FormValue("at"); at != "" {
+		if pending {
+			sendClientError(w, http.StatusBadRequest, "Error: at and pending=true can not both be set")
+			return
+		}
+		if h, err := strconv.ParseUint(at, 10, 64); err == nil {
+			if h >= chainLen() {
+				sendClientError(w, http.StatusBadRequest, fmt.Sprintf("Error: no committed block at height %d", h))
+				return
+			}
+			keep = func(loc *txLoc) bool { return loc.Height <= h }
+		} else if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
+			ns := t.UnixNano()
+			keep = func(loc *txLoc) bool { return loc.committedNs() <= ns }
+		} else {
+			sendClientError(w, http.StatusBadRequest,
+				fmt.Sprintf("Error: at must be a block height or an RFC3339 time; at=%q", at))
+			return
+		}
+	}
+
+	st, ok := keyLatest(key, pending, keep)
+	if !ok {
+		sendHTTPError(w, http.StatusNotFound, ErrKeyNotFound,
+			fmt.Sprintf("no value for key=%q", key), callerPar())
+		return
+	}
+	sendJSON(w, http.StatusOK, &keyValue{Key: key, Value: st.Tx.Value, txState: *st}, verblvl > 2)
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyAt(t *testing.T) {
+	fc := newTestChain(t)
+	mustAddTx(t, "k", "v1") // submitted at 0, committed at 1m.
+	fc.Advance(90 * time.Second)
+	mustAddTx(t, "k", "v2") // submitted at 1m30s, committed at 2m30s.
+	fc.Advance(time.Minute)
+	mustAddTx(t, "k", "v3") // pending.
+
+	at := func(d time.Duration) string { return testStart.Add(d).Format(time.RFC3339Nano) }
+	tests := []struct {
+		at    string
+		scode int
+		value string
+	}{
+		{"", http.StatusOK, "v2"},
+		{at(30 * time.Second), http.StatusNotFound, ""}, // v1 submitted, not yet committed.
+		{at(time.Minute), http.StatusOK, "v1"},
+		{at(2 * time.Minute), http.StatusOK, "v1"}, // v2 submitted, not yet committed.
+		{at(150 * time.Second), http.StatusOK, "v2"},
+		{at(time.Hour), http.StatusOK, "v2"},
+		{"0", http.StatusOK, "v1"},
+		{"1", http.StatusOK, "v2"},
+		{"2", http.StatusBadRequest, ""},
+		{"yesterday", http.StatusBadRequest, ""},
+	}
+	for _, tc := range tests {
+		w := serveTest(http.MethodGet, "/v1/keys/k?at="+tc.at, nil)
+		if w.Code != tc.scode {
+			t.Errorf("at=%s: status %d want %d: %s", tc.at, w.Code, tc.scode, w.Body.String())
+			continue
+		}
+		if tc.scode != http.StatusOK {
+			continue
+		}
+		var kv keyValue
+		if err := json.Unmarshal(w.Body.Bytes(), &kv); err != nil {
+			t.Fatalf("at=%s: response %q err:%v", tc.at, w.Body.String(), err)
+		}
+		if kv.Value != tc.value {
+			t.Errorf("at=%s: value %q want %q", tc.at, kv.Value, tc.value)
+		}
+	}
+}
+
+func TestKeyHistory(t *testing.T) {
+	const s = time.Second
+	at := func(d time.Duration) string { return testStart.Add(d).Format(time.RFC3339Nano) }
+	tests := []struct {
+		name    string
+		query   url.Values
+		commits int      // pages after which a block with another tx of the key is committed.
+		pages   []string // values of each page.
+	}{
+		{"asc", url.Values{"limit": {"2"}}, 2,
+			[]string{"v0 v1", "v2 v3", "v4 v5", "n0 n1"}},
+		{"desc", url.Values{"order": {"desc"}, "limit": {"2"}}, 2,
+			[]string{"v5 v4", "v3 v2", "v1 v0"}},
+		{"asc since until", url.Values{"since": {at(20 * s)}, "until": {at(50 * s)}, "limit": {"2"}}, 1,
+			[]string{"v2 v3", "v4"}},
+		{"desc since", url.Values{"order": {"desc"}, "since": {at(20 * s)}, "limit": {"2"}}, 2,
+			[]string{"v5 v4", "v3 v2"}},
+		{"asc reaches later commits", url.Values{"since": {at(40 * s)}, "limit": {"1"}}, 2,
+			[]string{"v4", "v5", "n0", "n1"}},
+		{"one page", url.Values{"limit": {"10"}}, 1,
+			[]string{"v0 v1 v2 v3 v4 v5"}},
+	}
+
+	for _, tc := range tests {
+		// blocks of 2 txs of k (v<i> submitted at i*10s) and one of o.
+		fc := newTestChain(t)
+		for i := 0; i < 6; i++ {
+			mustAddTx(t, "k", fmt.Sprintf("v%d", i))
+			if i%2 == 1 {
+				mustAddTx(t, "o", fmt.Sprintf("o%d", i))
+				blk.flush()
+			}
+			fc.Advance(10 * s)
+		}
+
+		var pages []string
+		cursor := ""
+		for p := 0; len(pages) < 10; p++ {
+			q := url.Values{"cursor": {cursor}}
+			for k, v := range tc.query {
+				q[k] = v
+			}
+			w := serveTest(http.MethodGet, "/v1/keys/k/history?"+q.Encode(), nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s page %d: status %d: %s", tc.name, p, w.Code, w.Body.String())
+			}
+			var page keyHistPage
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("%s page %d: response %q err:%v", tc.name, p, w.Body.String(), err)
+			}
+			var values []string
+			for _, loc := range page.Txs {
+				values = append(values, loc.Tx.Value)
+			}
+			pages = append(pages, strings.Join(values, " "))
+			if page.Next == "" {
+				break
+			}
+			cursor = page.Next
+			if p < tc.commits {
+				mustAddTx(t, "k", fmt.Sprintf("n%d", p))
+				blk.flush()
+				fc.Advance(10 * s)
+			}
+		}
+		if fmt.Sprint(pages) != fmt.Sprint(tc.pages) {
+			t.Errorf("%s: pages %q want %q", tc.name, pages, tc.pages)
+		}
+	}
+
+	newTestChain(t)
+	for _, q := range []string{"order=up", "since=yesterday", "limit=0", "cursor=" + strings.Repeat("a", 64)} {
+		if w := serveTest(http.MethodGet, "/v1/keys/k/history?"+q, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
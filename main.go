@@ -7,8 +7,6 @@
 package main
 
 import (
-	"time"
-
 	"github.com/phcurtis/fn"
 )
 
@@ -16,8 +14,14 @@ import (
 const Version = "0.04"
 
 func main() {
-	timeofinv = time.Now() // capture time of invocation.
 	prelimsCLI(false)
+
+	if verifyfile != "" {
+		msg, excode := verifyBlkfile(verifyfile)
+		fn.LogCondMsg(true, msg)
+		osExit(excode)
+	}
+
 	onExitFunc := fn.LogCondTraceMsgp(devMode || verblvl > 0, "")
 
 	msg, excode := APIserver()
@@ -0,0 +1,117 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// this file contains helpers shared by the tests: a fresh chain kept in a
+// memStore with a fakeClock, and transactions added to it.
+
+// testStart - the fakeClock time tests start at.
+var testStart = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestChain - resets the chain state to an empty memStore blockchain with
+// a fakeClock, default flags and no block committed during this invocation.
+func newTestChain(t *testing.T) *fakeClock {
+	t.Helper()
+	fc := newFakeClock(testStart)
+	clk = fc
+	timeofinv = fc.Now()
+
+	blktxmax, blkctime = 0, time.Minute
+	txhashver, txdupmode = hashVerCanon, dupModeReject
+	txownership, txrequiresig = false, false
+
+	bcmu.Lock()
+	blk = Blk{PrevHash: genesisPrevHash}
+	owners = make(map[string]*keyOwner)
+	commitsPaused, txnonce = false, 0
+	flushtimer, blkstart, flushdue = nil, time.Time{}, time.Time{}
+	totblkappSinv, tottxappSinv, totwrtbytesSinv, curblktxcnt = 0, 0, 0, 0
+	bcmu.Unlock()
+
+	idxmu.Lock()
+	keyIdx = make(map[string][]*txLoc)
+	txIdx = make(map[string]*txLoc)
+	blkIdx = make(map[string]uint64)
+	heightIdx = nil
+	idxmu.Unlock()
+
+	blkstore = newMemStore()
+	if err := blkstore.open(); err != nil {
+		t.Fatalf("memStore open err:%v", err)
+	}
+	return fc
+}
+
+// addTestTx - submits tx 'req' as /tx does, returning its rejection if any.
+func addTestTx(t *testing.T, req txReq) (*txStruct, *txErr) {
+	t.Helper()
+	tx, terr := req.newTx()
+	if terr != nil {
+		return nil, terr
+	}
+	return tx, tx.addToBlock()
+}
+
+// mustAddTx - submits an unsigned tx for 'key', failing the test if rejected.
+func mustAddTx(t *testing.T, key, value string) *txStruct {
+	t.Helper()
+	tx, terr := addTestTx(t, txReq{Key: key, Value: value})
+	if terr != nil {
+		t.Fatalf("tx key:%q value:%q rejected: %d %s", key, value, terr.code, terr.msg)
+	}
+	return tx
+}
+
+// testBlocks - commits 'nblk' blocks of 'ntx' transactions to a fresh test
+// chain and returns the chain as a blkchainDoc.
+func testBlocks(t *testing.T, nblk, ntx int) blkchainDoc {
+	t.Helper()
+	newTestChain(t)
+	for i := 0; i < nblk; i++ {
+		for j := 0; j < ntx; j++ {
+			mustAddTx(t, fmt.Sprintf("k%d", j), fmt.Sprintf("v%d.%d", i, j))
+		}
+		blk.flush()
+	}
+	return testDoc(t)
+}
+
+// testDoc - returns the blocks in blkstore as a blkchainDoc.
+func testDoc(t *testing.T) blkchainDoc {
+	t.Helper()
+	var doc blkchainDoc
+	err := blkstore.scanBlks(false, func(inv string, b *Blk, pos blkPos) error {
+		doc = doc.concat(blkchainDoc{{Name: inv, Blocks: []Blk{*b}}})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scanBlks err:%v", err)
+	}
+	return doc
+}
+
+// serveTest - serves request 'method' 'target' with 'body' (may be nil) via
+// the api routes.
+func serveTest(method, target string, body io.Reader) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	registerRoutes(r)
+	req := httptest.NewRequest(method, target, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
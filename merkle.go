@@ -0,0 +1,212 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to a block's merkle root and tx
+// inclusion proofs.
+
+// merkle tree: a leaf is sha256(0x00 || raw tx ID), in block order, a parent
+// is sha256(0x01 || left || right) and an odd node at the end of a level is
+// promoted to the next level unchanged. The distinct prefixes keep a parent
+// from passing as a leaf, and promoting (rather than pairing an odd node with
+// itself) keeps [a,b,c] and [a,b,c,c] from having the same root.
+
+func merkleLeaf(id []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0}, id...))
+	return sum[:]
+}
+
+func merkleParent(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return sum[:]
+}
+
+// merkleLevels - returns the levels of the merkle tree of tx 'ids', from the
+// leaves up to the root.
+func merkleLevels(ids []string) ([][][]byte, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("merkle: no tx IDs")
+	}
+	level := make([][]byte, len(ids))
+	for i, id := range ids {
+		raw, err := hex.DecodeString(id)
+		if err != nil {
+			return nil, fmt.Errorf("merkle: tx ID:%q %v", id, err)
+		}
+		level[i] = merkleLeaf(raw)
+	}
+
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i]) // odd node promoted.
+				continue
+			}
+			next = append(next, merkleParent(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels, nil
+}
+
+// merklePathLen - returns the number of siblings on the path from leaf 'pos'
+// to the root of a tree of 'n' leaves, promoted levels have none.
+func merklePathLen(pos, n int) int {
+	steps := 0
+	for ; n > 1; pos, n = pos/2, (n+1)/2 {
+		if pos^1 < n {
+			steps++
+		}
+	}
+	return steps
+}
+
+// txIDs - returns the IDs of the block's transactions.
+func (b *Blk) txIDs() []string {
+	ids := make([]string, len(b.Transactions))
+	for i := range b.Transactions {
+		ids[i] = b.Transactions[i].ID
+	}
+	return ids
+}
+
+// computeMerkleRoot - returns the hexed merkle root of the block's tx IDs.
+func (b *Blk) computeMerkleRoot() (string, error) {
+	levels, err := merkleLevels(b.txIDs())
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(levels[len(levels)-1][0]), nil
+}
+
+// merkleStep - a sibling on the path from a tx ID to the merkle root.
+type merkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // sibling is the left child.
+}
+
+// merkleProof - proof that tx TxID is included in block BlockHash.
+type merkleProof struct {
+	TxID        string       `json:"id"`
+	Position    int          `json:"position"`
+	TxCount     int          `json:"txcount"` // transactions in the block.
+	HashVer     int          `json:"hashver"` // of the block.
+	Path        []merkleStep `json:"path"`
+	MerkleRoot  string       `json:"merkle-root"`
+	Height      uint64       `json:"height"`
+	TimeStampNs int64        `json:"timestampns,omitempty"`
+	PrevHash    string       `json:"prev-block-hash"`
+	BlockHash   string       `json:"block-hash"`
+}
+
+// proveTx - returns the inclusion proof of the tx at 'pos' in block b.
+func (b *Blk) proveTx(pos int) (*merkleProof, error) {
+	levels, err := merkleLevels(b.txIDs())
+	if err != nil {
+		return nil, err
+	}
+	p := &merkleProof{TxID: b.Transactions[pos].ID, Position: pos, TxCount: len(b.Transactions),
+		HashVer: b.HashVer, Path: []merkleStep{}, MerkleRoot: b.MerkleRoot, Height: b.Height, TimeStampNs: b.TimeStampNs,
+		PrevHash: b.PrevHash, BlockHash: b.BlockHash}
+	idx := pos
+	for _, level := range levels[:len(levels)-1] {
+		if sibidx := idx ^ 1; sibidx < len(level) {
+			p.Path = append(p.Path, merkleStep{Hash: hex.EncodeToString(level[sibidx]), Left: idx%2 == 1})
+		}
+		idx /= 2
+	}
+	return p, nil
+}
+
+// verify - checks that the proof's path, as its Position and TxCount require,
+// leads from TxID to MerkleRoot and that MerkleRoot with the other block
+// header fields (per HashVer) hashes to 'blockHash', the hash of a block the
+// caller trusts.
+func (p *merkleProof) verify(blockHash string) error {
+	if p.Position < 0 || p.Position >= p.TxCount {
+		return fmt.Errorf("merkle proof: position:%d not within txcount:%d", p.Position, p.TxCount)
+	}
+	if n := merklePathLen(p.Position, p.TxCount); len(p.Path) != n {
+		return fmt.Errorf("merkle proof: path has %d steps, position:%d of txcount:%d needs %d",
+			len(p.Path), p.Position, p.TxCount, n)
+	}
+	raw, err := hex.DecodeString(p.TxID)
+	if err != nil {
+		return fmt.Errorf("merkle proof: tx ID:%q %v", p.TxID, err)
+	}
+	node := merkleLeaf(raw)
+	idx, n, si := p.Position, p.TxCount, 0
+	for ; n > 1; idx, n = idx/2, (n+1)/2 {
+		if idx^1 >= n {
+			continue // promoted.
+		}
+		step := p.Path[si]
+		si++
+		sib, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return fmt.Errorf("merkle proof: path hash:%q %v", step.Hash, err)
+		}
+		if step.Left != (idx%2 == 1) {
+			return fmt.Errorf("merkle proof: path step:%d side does not match position:%d", si-1, p.Position)
+		}
+		if step.Left {
+			node = merkleParent(sib, node)
+		} else {
+			node = merkleParent(node, sib)
+		}
+	}
+	root, err := hex.DecodeString(p.MerkleRoot)
+	if err != nil || !bytes.Equal(node, root) {
+		return fmt.Errorf("merkle proof: path does not lead to merkle root:%q", p.MerkleRoot)
+	}
+	b := Blk{HashVer: p.HashVer, Height: p.Height, TimeStampNs: p.TimeStampNs, PrevHash: p.PrevHash,
+		MerkleRoot: p.MerkleRoot}
+	if hash := b.hdrHash(p.TxCount); hash != blockHash {
+		return fmt.Errorf("merkle proof: block hash:%q computed:%q", blockHash, hash)
+	}
+	return nil
+}
+
+// cepProof - client entry point for: /proof?id=txid.
+func cepProof(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	id := r.FormValue("id")
+	if id == "" {
+		sendClientError(w, http.StatusBadRequest, "Error: tx id must be set")
+		return
+	}
+
+	loc, ok := lookupTx(id)
+	if !ok {
+		sendClientError(w, http.StatusNotFound, fmt.Sprintf("Error: no committed tx with id=%q", id))
+		return
+	}
+	b, _ := lookupBlkLoc(loc.BlockHash)
+	if b.MerkleRoot == "" {
+		sendClientError(w, http.StatusConflict,
+			fmt.Sprintf("Error: block %q predates merkle roots, no proof possible", b.BlockHash))
+		return
+	}
+
+	p, err := b.proveTx(loc.Position)
+	if err != nil {
+		sendHTTPError(w, http.StatusInternalServerError, ErrMerkleProof, err.Error(), callerPar())
+		return
+	}
+	sendJSON(w, http.StatusOK, p, verblvl > 2)
+}
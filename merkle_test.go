@@ -0,0 +1,135 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+// testBlk - returns the single committed block of a fresh test chain with
+// 'ntx' transactions.
+func testBlk(t *testing.T, ntx int) Blk {
+	t.Helper()
+	doc := testBlocks(t, 1, ntx)
+	return doc[0].Blocks[0]
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		b := testBlk(t, n)
+		for pos := 0; pos < n; pos++ {
+			p, err := b.proveTx(pos)
+			if err != nil {
+				t.Fatalf("txs:%d pos:%d proveTx err:%v", n, pos, err)
+			}
+			if len(p.Path) != merklePathLen(pos, n) {
+				t.Errorf("txs:%d pos:%d path has %d steps want %d", n, pos, len(p.Path), merklePathLen(pos, n))
+			}
+			if err = p.verify(b.BlockHash); err != nil {
+				t.Errorf("txs:%d pos:%d verify err:%v", n, pos, err)
+			}
+		}
+	}
+}
+
+func TestMerkleOddCount(t *testing.T) {
+	b := testBlk(t, 3)
+	ids := b.txIDs()
+	root := func(ids []string) string {
+		b := Blk{Transactions: make([]txStruct, len(ids))}
+		for i, id := range ids {
+			b.Transactions[i].ID = id
+		}
+		r, err := b.computeMerkleRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if root(ids) == root(append(ids, ids[2])) {
+		t.Errorf("txs [a,b,c] and [a,b,c,c] have the same merkle root")
+	}
+	if root(ids[:1]) == ids[0] {
+		t.Errorf("merkle root of one tx is its ID, leaves are not prefixed")
+	}
+}
+
+func TestMerkleProofTampered(t *testing.T) {
+	doc := testBlocks(t, 2, 5)
+	b, other := doc[0].Blocks[0], doc[0].Blocks[1]
+	tests := []struct {
+		name   string
+		pos    int
+		tamper func(p *merkleProof) string // returns the trusted block hash.
+	}{
+		{"other block hash", 2, func(p *merkleProof) string { return other.BlockHash }},
+		{"proof's own block hash of another root", 2, func(p *merkleProof) string {
+			p.MerkleRoot = other.MerkleRoot
+			return b.BlockHash
+		}},
+		{"tx ID", 2, func(p *merkleProof) string {
+			p.TxID = other.Transactions[2].ID
+			return b.BlockHash
+		}},
+		{"position", 2, func(p *merkleProof) string {
+			p.Position = 3
+			return b.BlockHash
+		}},
+		{"position out of range", 2, func(p *merkleProof) string {
+			p.Position = 5
+			return b.BlockHash
+		}},
+		{"txcount", 2, func(p *merkleProof) string {
+			p.TxCount = 4
+			return b.BlockHash
+		}},
+		{"path side", 2, func(p *merkleProof) string {
+			p.Path[0].Left = !p.Path[0].Left
+			return b.BlockHash
+		}},
+		{"path hash", 2, func(p *merkleProof) string {
+			p.Path[1].Hash = p.Path[0].Hash
+			return b.BlockHash
+		}},
+		{"path step dropped", 2, func(p *merkleProof) string {
+			p.Path = p.Path[:len(p.Path)-1]
+			return b.BlockHash
+		}},
+		{"path step added to promoted leaf", 4, func(p *merkleProof) string {
+			p.Path = append([]merkleStep{{Hash: b.Transactions[3].ID, Left: true}}, p.Path...)
+			return b.BlockHash
+		}},
+		{"height", 2, func(p *merkleProof) string {
+			p.Height++
+			return b.BlockHash
+		}},
+		{"prev hash", 2, func(p *merkleProof) string {
+			p.PrevHash = genesisPrevHash[1:] + "1"
+			return b.BlockHash
+		}},
+		{"hashver", 2, func(p *merkleProof) string {
+			p.HashVer = blkHashVerLegacy
+			return b.BlockHash
+		}},
+	}
+
+	for _, tc := range tests {
+		p, err := b.proveTx(tc.pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Path = append([]merkleStep{}, p.Path...)
+		if err = p.verify(tc.tamper(p)); err == nil {
+			t.Errorf("%s: tampered proof verified", tc.name)
+		}
+	}
+	p, _ := b.proveTx(4)
+	if err := p.verify(b.BlockHash); err != nil {
+		t.Errorf("untampered proof: err:%v", err)
+	}
+	if len(p.Path) != 1 {
+		t.Errorf("promoted leaf 4 of 5 has %d path steps want 1", len(p.Path))
+	}
+}
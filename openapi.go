@@ -0,0 +1,318 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions generating the OpenAPI 3 document of the
+// registered api routes (see routes.go), served at /v1/openapi.json. Request
+// and response schemas are derived from the go types sent and their json tags.
+
+// openapiJSON - the OpenAPI document, set by routesSetup.
+var openapiJSON []byte
+
+// jsonObj - a json object of the OpenAPI document.
+type jsonObj map[string]interface{}
+
+// openapiDoc - returns the OpenAPI 3 document describing 'routes'.
+func openapiDoc(routes []apiRoute) jsonObj {
+	g := &schemaGen{schemas: jsonObj{}}
+	paths := jsonObj{}
+	for _, rt := range routes {
+		paths[openapiPath(apiPrefix+rt.Path)] = g.pathItem(rt, false)
+		if rt.Legacy {
+			paths[openapiPath(rt.Path)] = g.pathItem(rt, true)
+		}
+	}
+	return jsonObj{
+		"openapi": "3.0.3",
+		"info": jsonObj{
+			"title":   "blkchain",
+			"version": Version,
+			"description": "A limited blockchain simulator. Unversioned paths are deprecated aliases of " +
+				apiPrefix + " ones. Errors are sent as a cerrEnvelope (with -devmode its error member has " +
+				"statuscode, statuscodetext, errcode, errtext, errmsg and caller) or, for invalid client " +
+				"input, an errStruct.",
+		},
+		"paths":      paths,
+		"components": jsonObj{"schemas": g.schemas},
+	}
+}
+
+// openapiPath - returns mux path template 'tmpl' without its variables'
+// patterns, e.g. /blocks/{hash:[0-9a-f]{64}} is /blocks/{hash}.
+func openapiPath(tmpl string) string {
+	var b strings.Builder
+	depth := 0
+	skip := false
+	for _, c := range tmpl {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				b.WriteRune(c)
+				continue
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skip = false
+				b.WriteRune(c)
+				continue
+			}
+		case c == ':' && depth == 1:
+			skip = true
+		}
+		if !skip {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// pathPatterns - returns the patterns of the variables of mux path template 'tmpl'.
+func pathPatterns(tmpl string) map[string]string {
+	pats := make(map[string]string)
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			return pats
+		}
+		depth, j := 0, i
+		for ; j < len(tmpl); j++ {
+			if tmpl[j] == '{' {
+				depth++
+			} else if tmpl[j] == '}' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if j == len(tmpl) {
+			return pats
+		}
+		if v := strings.SplitN(tmpl[i+1:j], ":", 2); len(v) == 2 {
+			pats[v[0]] = "^" + v[1] + "$"
+		}
+		tmpl = tmpl[j+1:]
+	}
+}
+
+// schemaGen - generates schemas, named ones are added to schemas.
+type schemaGen struct {
+	schemas jsonObj
+}
+
+// pathItem - returns the OpenAPI path item of route rt.
+func (g *schemaGen) pathItem(rt apiRoute, legacy bool) jsonObj {
+	methods := rt.Methods
+	if methods == nil {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+	pats := pathPatterns(rt.Path)
+	item := jsonObj{}
+	for _, m := range methods {
+		op := jsonObj{
+			"summary":     rt.Summary,
+			"operationId": operationID(m, rt.Path, legacy),
+			"responses":   g.responses(rt.Resps),
+		}
+		if legacy {
+			op["deprecated"] = true
+		}
+		var params []jsonObj
+		for _, p := range rt.Params {
+			schema := jsonObj{"type": p.Type}
+			if pat, ok := pats[p.Name]; ok {
+				schema["pattern"] = pat
+			}
+			params = append(params, jsonObj{"name": p.Name, "in": p.In, "required": p.Required,
+				"description": p.Desc, "schema": schema})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if m == http.MethodPost && (rt.Body != nil || rt.Form) {
+			op["requestBody"] = g.requestBody(rt)
+		}
+		item[strings.ToLower(m)] = op
+	}
+	return item
+}
+
+// operationID - returns a unique id of an operation, e.g. getBlocksHeightN.
+func operationID(method, path string, legacy bool) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(openapiPath(path), "/") {
+		part = strings.Trim(part, "{}")
+		if part == "" {
+			continue
+		}
+		for _, word := range strings.Split(part, ".") {
+			id += upperFirst(word)
+		}
+	}
+	if legacy {
+		id += "Legacy"
+	}
+	return id
+}
+
+// upperFirst - returns 's' with its first byte uppercased if an ASCII lowercase letter.
+func upperFirst(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-'a'+'A') + s[1:]
+}
+
+// requestBody - returns the OpenAPI request body of route rt.
+func (g *schemaGen) requestBody(rt apiRoute) jsonObj {
+	content := jsonObj{}
+	if rt.Body != nil {
+		content["application/json"] = jsonObj{"schema": g.bodySchema(rt.Body)}
+	}
+	if rt.Form {
+		props := jsonObj{}
+		for _, p := range rt.Params {
+			if p.In == "query" {
+				props[p.Name] = jsonObj{"type": p.Type, "description": p.Desc}
+			}
+		}
+		content["application/x-www-form-urlencoded"] = jsonObj{"schema": jsonObj{"type": "object", "properties": props}}
+	}
+	return jsonObj{"required": rt.Body != nil && !rt.Form, "content": content}
+}
+
+// responses - returns the OpenAPI responses of 'resps'.
+func (g *schemaGen) responses(resps map[int]apiResp) jsonObj {
+	obj := jsonObj{}
+	for code, r := range resps {
+		resp := jsonObj{"description": r.Desc}
+		if r.Body != nil {
+			ctype := r.CType
+			if ctype == "" {
+				ctype = "application/json"
+			}
+			resp["content"] = jsonObj{ctype: jsonObj{"schema": g.bodySchema(r.Body)}}
+		}
+		obj[fmt.Sprintf("%d", code)] = resp
+	}
+	return obj
+}
+
+// bodySchema - returns the schema of body, a value or a oneOf of values.
+func (g *schemaGen) bodySchema(body interface{}) jsonObj {
+	if alts, ok := body.(oneOf); ok {
+		var schemas []jsonObj
+		for _, alt := range alts {
+			schemas = append(schemas, g.schema(reflect.TypeOf(alt)))
+		}
+		return jsonObj{"oneOf": schemas}
+	}
+	return g.schema(reflect.TypeOf(body))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema - returns the schema of go type t as encoding/json marshals it,
+// a $ref for named struct types.
+func (g *schemaGen) schema(t reflect.Type) jsonObj {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return jsonObj{"type": "string"}
+	case reflect.Bool:
+		return jsonObj{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObj{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObj{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return jsonObj{"type": "string", "format": "byte"}
+		}
+		return jsonObj{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return jsonObj{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return jsonObj{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = jsonObj{} // placeholder in case t refers to itself.
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return jsonObj{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return jsonObj{}
+}
+
+// object - returns the object schema of struct type t.
+func (g *schemaGen) object(t reflect.Type) jsonObj {
+	props := jsonObj{}
+	var required []string
+	g.fields(t, props, &required)
+	obj := jsonObj{"type": "object", "properties": props}
+	if required != nil {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// fields - adds the json members of struct type t to props, those always
+// present to required; embedded structs without a json name are flattened.
+func (g *schemaGen) fields(t reflect.Type, props jsonObj, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props, required)
+			continue
+		}
+		if f.PkgPath != "" { // unexported.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		omit := false
+		for _, o := range opts[1:] {
+			omit = omit || o == "omitempty"
+		}
+		if !omit && f.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// cepOpenAPI - client entry point for: /v1/openapi.json.
+func cepOpenAPI(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	writeJSON(w, http.StatusOK, openapiJSON, openapiJSON, false)
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// this file contains functions related to key ownership (-tx.ownership).
+// The first signed transaction for a key registers its pubkey as the key's
+// owner; the owner may authorize a delegate via a signed transaction with
+// its Delegate set. With -tx.ownership, writes to an owned key must be
+// signed by its owner or one of its delegates. A signature covers the ID of
+// the key's last tx (see signBytes), so a signed tx is only accepted against
+// the chain state it was signed for and can not be replayed to register,
+// delegate or roll the key back.
+
+// keyOwner - ownership of a key.
+type keyOwner struct {
+	owner     string          // hexed pubkey.
+	delegates map[string]bool // hexed pubkeys.
+}
+
+// owners - key to its ownership, rebuilt from the chain at startup and kept
+// current as transactions are added to blk; guarded by bcmu.
+var owners = make(map[string]*keyOwner)
+
+// applyOwner - updates ownership with tx; expects bcmu.Lock mutex to be active.
+func applyOwner(tx *txStruct) {
+	if tx.PubKey == "" {
+		return
+	}
+	o := owners[tx.Key]
+	if o == nil {
+		o = &keyOwner{owner: tx.PubKey, delegates: make(map[string]bool)}
+		owners[tx.Key] = o
+	}
+	if tx.Delegate != "" && tx.PubKey == o.owner {
+		o.delegates[tx.Delegate] = true
+	}
+}
+
+// checkOwner - checks a signed tx was signed for its key's last tx (of
+// 'batch', may be nil, pending or committed) and tx may write its key; expects
+// bcmu.Lock mutex to be active.
+func checkOwner(tx *txStruct, batch *batchSeen) *txErr {
+	if terr := checkPrevll(tx, batch); terr != nil {
+		return terr
+	}
+	if !txownership {
+		return nil
+	}
+	o := owners[tx.Key]
+	if o == nil || tx.PubKey == o.owner {
+		return nil
+	}
+	if o.delegates[tx.PubKey] {
+		if tx.Delegate == "" {
+			return nil
+		}
+		return &txErr{http.StatusForbidden, ErrTxNotOwner,
+			fmt.Sprintf("key %q: only its owner may authorize a delegate", tx.Key)}
+	}
+	return &txErr{http.StatusForbidden, ErrTxNotOwner,
+		fmt.Sprintf("key %q is owned; tx must be signed by its owner or a delegate", tx.Key)}
+}
+
+// saveOwner - saves the ownership of 'key' in 'undo' unless already saved, so
+// restoreOwners can undo changes applyOwner makes; expects bcmu.Lock mutex to be active.
+func saveOwner(undo map[string]*keyOwner, key string) {
+	if _, ok := undo[key]; ok {
+		return
+	}
+	o := owners[key]
+	if o != nil {
+		oc := &keyOwner{owner: o.owner, delegates: make(map[string]bool, len(o.delegates))}
+		for d := range o.delegates {
+			oc.delegates[d] = true
+		}
+		o = oc
+	}
+	undo[key] = o
+}
+
+// restoreOwners - restores the ownerships saved in 'undo'; expects bcmu.Lock mutex to be active.
+func restoreOwners(undo map[string]*keyOwner) {
+	for key, o := range undo {
+		if o == nil {
+			delete(owners, key)
+			continue
+		}
+		owners[key] = o
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey - returns the ed25519 key generated from a seed of 'c' bytes.
+func testKey(c byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed([]byte(strings.Repeat(string(c), ed25519.SeedSize)))
+}
+
+// pubHex - returns the hexed public key of 'priv'.
+func pubHex(priv ed25519.PrivateKey) string {
+	return hex.EncodeToString(priv.Public().(ed25519.PublicKey))
+}
+
+// signReq - returns tx submission 'req' signed by 'priv'.
+func signReq(priv ed25519.PrivateKey, req txReq) txReq {
+	tx := txStruct{Key: req.Key, Value: req.Value, PrevID: req.PrevID, Delegate: req.Delegate, Meta: req.Meta}
+	req.PubKey = pubHex(priv)
+	req.Sig = hex.EncodeToString(ed25519.Sign(priv, tx.signBytes()))
+	return req
+}
+
+// signedReq - returns a tx submission for 'key' signed by 'priv' for the
+// key's last tx 'previd', authorizing 'delegate' if set.
+func signedReq(priv ed25519.PrivateKey, key, value, previd, delegate string) txReq {
+	return signReq(priv, txReq{Key: key, Value: value, PrevID: previd, Delegate: delegate})
+}
+
+func TestOwnership(t *testing.T) {
+	owner, deleg, other := testKey('o'), testKey('d'), testKey('x')
+
+	// previd values resolved when the step runs.
+	const (
+		last  = "last"  // ID of the key's last tx.
+		stale = "stale" // ID of the key's tx before its last.
+	)
+	tests := []struct {
+		name     string
+		signer   ed25519.PrivateKey // nil for unsigned.
+		key      string
+		previd   string
+		delegate ed25519.PrivateKey
+		commit   bool // commit the pending block first.
+		want     int  // error code, 0 if added.
+	}{
+		{"owner registers", owner, "k", last, nil, false, 0},
+		{"unsigned", nil, "k", "", nil, false, ErrTxNotOwner},
+		{"other signer", other, "k", last, nil, false, ErrTxNotOwner},
+		{"owner writes", owner, "k", last, nil, false, 0},
+		{"owner replays a stale signature", owner, "k", stale, nil, false, ErrTxPrevID},
+		{"owner signs without previd", owner, "k", "", nil, false, ErrTxPrevID},
+		{"owner authorizes delegate", owner, "k", last, deleg, false, 0},
+		{"delegate writes", deleg, "k", last, nil, false, 0},
+		{"delegate authorizes another", deleg, "k", last, other, false, ErrTxNotOwner},
+		{"owner writes after commit", owner, "k", last, nil, true, 0},
+		{"delegate stale after commit", deleg, "k", stale, nil, true, ErrTxPrevID},
+		{"delegate writes after commit", deleg, "k", last, nil, false, 0},
+		{"other registers another key", other, "k2", last, nil, false, 0},
+		{"owner of k can not write k2", owner, "k2", last, nil, false, ErrTxNotOwner},
+		{"unsigned write to an unowned key", nil, "k3", "", nil, false, 0},
+	}
+
+	fc := newTestChain(t)
+	txownership = true
+	ids := make(map[string][]string) // key to the IDs of its added txs.
+	for i, tc := range tests {
+		fc.Advance(time.Second) // distinct tx IDs.
+		if tc.commit {
+			blk.flush()
+		}
+		req := txReq{Key: tc.key, Value: tc.name}
+		if tc.signer != nil {
+			previd := ""
+			if n := len(ids[tc.key]); tc.previd == last && n > 0 {
+				previd = ids[tc.key][n-1]
+			} else if tc.previd == stale && n > 1 {
+				previd = ids[tc.key][n-2]
+			}
+			delegate := ""
+			if tc.delegate != nil {
+				delegate = pubHex(tc.delegate)
+			}
+			req = signedReq(tc.signer, tc.key, tc.name, previd, delegate)
+		}
+		tx, terr := addTestTx(t, req)
+		switch {
+		case terr == nil && tc.want != 0:
+			t.Errorf("%d %s: added want err %d", i, tc.name, tc.want)
+		case terr != nil && terr.code != tc.want:
+			t.Errorf("%d %s: err %d %s want %d", i, tc.name, terr.code, terr.msg, tc.want)
+		}
+		if terr == nil {
+			ids[tc.key] = append(ids[tc.key], tx.ID)
+		}
+	}
+
+	// the chain with its signed txs verifies.
+	blk.flush()
+	if _, verr := verifyChain(testDoc(t)); verr != nil {
+		t.Errorf("verify err:%v", verr)
+	}
+}
+
+func TestSignedTxChecks(t *testing.T) {
+	key := testKey('s')
+	tests := []struct {
+		name string
+		req  func() txReq
+		want int
+	}{
+		{"signed", func() txReq { return signedReq(key, "k", "v", "", "") }, 0},
+		{"value changed after signing", func() txReq {
+			req := signedReq(key, "k", "v", "", "")
+			req.Value = "w"
+			return req
+		}, ErrTxSigInvalid},
+		{"previd changed after signing", func() txReq {
+			req := signedReq(key, "k", "v", "", "")
+			req.PrevID = strings.Repeat("a", 64)
+			return req
+		}, ErrTxSigInvalid},
+		{"signed meta", func() txReq {
+			return signReq(key, txReq{Key: "k", Value: "v", Meta: map[string]string{"src": "job7", "a": "b"}})
+		}, 0},
+		{"meta changed after signing", func() txReq {
+			req := signReq(key, txReq{Key: "k", Value: "v", Meta: map[string]string{"src": "job7"}})
+			req.Meta = map[string]string{"src": "job8"}
+			return req
+		}, ErrTxSigInvalid},
+		{"meta added after signing", func() txReq {
+			req := signedReq(key, "k", "v", "", "")
+			req.Meta = map[string]string{"src": "job7"}
+			return req
+		}, ErrTxSigInvalid},
+		{"previd unsigned", func() txReq { return txReq{Key: "k", Value: "v", PrevID: strings.Repeat("a", 64)} }, ErrTxSigMissing},
+		{"delegate unsigned", func() txReq { return txReq{Key: "k", Value: "v", Delegate: pubHex(key)} }, ErrTxSigMissing},
+		{"malformed pubkey", func() txReq {
+			req := signedReq(key, "k", "v", "", "")
+			req.PubKey = "zz"
+			return req
+		}, ErrTxSigMalformed},
+	}
+	for _, tc := range tests {
+		newTestChain(t)
+		_, terr := addTestTx(t, tc.req())
+		switch {
+		case terr == nil && tc.want != 0:
+			t.Errorf("%s: added want err %d", tc.name, tc.want)
+		case terr != nil && terr.code != tc.want:
+			t.Errorf("%s: err %d %s want %d", tc.name, terr.code, terr.msg, tc.want)
+		}
+	}
+}
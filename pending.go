@@ -0,0 +1,53 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to the pending (not yet committed) block.
+
+// pendingInfo - the pending block: its transactions and when it will be
+// committed, by flushtimer at CommitDue or once it has TxMax transactions.
+type pendingInfo struct {
+	Count        uint64     `json:"count"`
+	Paused       bool       `json:"paused"`              // commits are paused, see admin.go
+	Started      *time.Time `json:"started,omitempty"`   // when it got its first transaction.
+	CommitDue    *time.Time `json:"commitdue,omitempty"` // unset if no timer is running.
+	CommitTime   string     `json:"blkctime"`
+	TxMax        int        `json:"txmax"` // <1 =off.
+	PrevHash     string     `json:"prev-block-hash"`
+	Transactions []txStruct `json:"transactions"`
+}
+
+// pending - returns a snapshot of the pending block.
+func pending() *pendingInfo {
+	defer fn.LogCondTrace(verblvl > 2)()
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	p := &pendingInfo{Count: atomic.LoadUint64(&curblktxcnt), Paused: commitsPaused, CommitTime: blkctimestr, TxMax: blktxmax,
+		PrevHash: blk.PrevHash, Transactions: append([]txStruct{}, blk.Transactions...)}
+	if !blkstart.IsZero() {
+		t := blkstart
+		p.Started = &t
+	}
+	if !flushdue.IsZero() {
+		t := flushdue
+		p.CommitDue = &t
+	}
+	return p
+}
+
+// cepPending - client entry point for: /pending.
+func cepPending(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	sendJSON(w, http.StatusOK, pending(), verblvl > 2)
+}
@@ -33,19 +33,31 @@ func writeJSON(w http.ResponseWriter, scode int, data, fullData []byte, verbose
 	writeRaw(w, data)
 }
 
+// ierrdetails - internal (and verbose) details of an error, sent in devMode.
+type ierrdetails struct {
+	HTTPscode     int    `json:"statuscode"`
+	HTTPscodeText string `json:"statuscodetext"`
+	ErrCode       int    `json:"errcode"`
+	ErrText       string `json:"errtext"`
+	ErrMsg        string `json:"errmsg"`
+	Caller        string `json:"caller"`
+}
+
+// cerrdetails - client (limited) details of an error.
+type cerrdetails struct {
+	HTTPscode int    `json:"clientstatuscode"`
+	ClientMsg string `json:"clientmsg"`
+}
+
+// cerrEnvelope - the error sendHTTPError sends (ierrdetails in devMode).
+type cerrEnvelope struct {
+	Details cerrdetails `json:"error"`
+}
+
 func sendHTTPError(w http.ResponseWriter, httpScode, errCode int, errMsg, caller string) {
 	hst := http.StatusText(httpScode)
 
 	// prep stuff for internal (and verbose) details of error
-	type ierrdetails struct {
-		HTTPscode     int    `json:"statuscode"`
-		HTTPscodeText string `json:"statuscodetext"`
-		ErrCode       int    `json:"errcode"`
-		ErrText       string `json:"errtext"`
-		ErrMsg        string `json:"errmsg"`
-		Caller        string `json:"caller"`
-	}
-
 	ibytes, ierr := json.MarshalIndent(struct {
 		Details ierrdetails `json:"error"`
 	}{ierrdetails{httpScode, hst, errCode, errText[errCode], errMsg, caller}}, "", "\t")
@@ -54,18 +66,47 @@ func sendHTTPError(w http.ResponseWriter, httpScode, errCode int, errMsg, caller
 	}
 
 	// prep stuff for client (limited) details of error
-	type cerrdetails struct {
-		HTTPscode int    `json:"clientstatuscode"`
-		ClientMsg string `json:"clientmsg"`
-	}
 	clientMsg := fmt.Sprintf("'%d':[%s; icode=%d]", httpScode, hst, errCode)
 
-	cbytes, cerr := json.MarshalIndent(struct {
-		Details cerrdetails `json:"error"`
-	}{cerrdetails{httpScode, clientMsg}}, "", "\t")
+	cbytes, cerr := json.MarshalIndent(cerrEnvelope{cerrdetails{httpScode, clientMsg}}, "", "\t")
 	if cerr != nil {
 		logPanic(cerr)
 	}
 
 	writeJSON(w, httpScode, cbytes, ibytes, verblvl > 0)
 }
+
+// sendJSON - marshals v and writes it to the client with http status 'scode'.
+func sendJSON(w http.ResponseWriter, scode int, v interface{}, verbose bool) {
+	bytes, jerr := json.Marshal(v)
+	if jerr != nil {
+		sendHTTPError(w, http.StatusInternalServerError, ErrJSONmarshal,
+			"error JSON marshal:"+jerr.Error(), "callerFunc:"+fn.LvlInfoShort(fn.Lpar))
+		return
+	}
+	writeJSON(w, scode, bytes, bytes, verbose)
+}
+
+// sendClientError - writes 'msg' to the client as an errStruct with http status 'scode'.
+func sendClientError(w http.ResponseWriter, scode int, msg string) {
+	sendJSON(w, scode, errStruct{ClientErrMsg: msg}, true)
+}
+
+// writeEvent - writes a server-sent event (text/event-stream) and flushes it
+// to the client; unlike writeRaw an error (e.g. client gone) is returned.
+func writeEvent(w http.ResponseWriter, id uint64, event string, data []byte) error {
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// writeEventComment - writes a server-sent event comment, e.g. a keepalive.
+func writeEventComment(w http.ResponseWriter, comment string) error {
+	if _, err := fmt.Fprintf(w, ": %s\n\n", comment); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
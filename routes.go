@@ -0,0 +1,227 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// this file contains the api route table. Each route is registered under
+// apiPrefix and, if it predates it, also unversioned as a deprecated alias;
+// the OpenAPI document (see openapi.go) is generated from the same table.
+
+// apiPrefix - path prefix of the current api version.
+const apiPrefix = "/v1"
+
+// apiParam - a query, path or header parameter of a route.
+type apiParam struct {
+	Name     string
+	In       string // query, path or header.
+	Type     string // string, integer or boolean.
+	Required bool
+	Desc     string
+}
+
+// apiResp - a response of a route, Body is a value of the go type sent (or
+// a oneOf of them), nil if none.
+type apiResp struct {
+	Desc  string
+	Body  interface{}
+	CType string // "" =application/json.
+}
+
+// oneOf - an apiResp.Body or apiRoute.Body that is one of several go types.
+type oneOf []interface{}
+
+// apiRoute - an api route.
+type apiRoute struct {
+	Path    string   // mux path template relative to apiPrefix.
+	Methods []string // nil =any method, documented as GET and POST.
+	Handler http.HandlerFunc
+	Summary string
+	Params  []apiParam
+	Body    interface{} // json request body, nil if none.
+	Form    bool        // Params may also be sent as a POST form body.
+	Resps   map[int]apiResp
+	Legacy  bool        // also registered unversioned, deprecated.
+	Enabled func() bool // nil =always.
+}
+
+func qparam(name, typ, desc string) apiParam {
+	return apiParam{Name: name, In: "query", Type: typ, Desc: desc}
+}
+
+func pparam(name, desc string) apiParam {
+	return apiParam{Name: name, In: "path", Type: "string", Required: true, Desc: desc}
+}
+
+// common responses.
+var (
+	respBadReq    = apiResp{Desc: "invalid request", Body: errStruct{}}
+	respNotFound  = apiResp{Desc: "not found", Body: cerrEnvelope{}}
+	respTxBadReq  = apiResp{Desc: "invalid request or malformed signature", Body: oneOf{errStruct{}, cerrEnvelope{}}}
+	respTxRejects = map[int]apiResp{
+		http.StatusUnauthorized:         {Desc: "signature missing", Body: cerrEnvelope{}},
+		http.StatusForbidden:            {Desc: "signature invalid or key not owned by signer", Body: cerrEnvelope{}},
+		http.StatusConflict:             {Desc: "duplicate transaction or signed previd not the key's last tx", Body: cerrEnvelope{}},
+		http.StatusUnsupportedMediaType: {Desc: "unsupported content type", Body: cerrEnvelope{}},
+	}
+)
+
+// with - returns resps plus those of 'more'.
+func with(resps map[int]apiResp, more map[int]apiResp) map[int]apiResp {
+	all := make(map[int]apiResp, len(resps)+len(more))
+	for code, r := range more {
+		all[code] = r
+	}
+	for code, r := range resps {
+		all[code] = r
+	}
+	return all
+}
+
+// apiRoutes - the api route table.
+func apiRoutes() []apiRoute {
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+	txParams := []apiParam{
+		qparam("key", "string", "transaction key, required unless a json body is sent"),
+		qparam("value", "string", "transaction value, required unless a json body is sent"),
+		qparam("pubkey", "string", "hexed ed25519 public key of the signer"),
+		qparam("sig", "string", "hexed ed25519 signature of the canonical tx bytes (key, value, previd, delegate, meta)"),
+		qparam("previd", "string", "ID of the key's last tx, signed with the tx; required if signed and the key has one"),
+		qparam("delegate", "string", "hexed public key the key's owner authorizes"),
+		qparam("wait", "string", "commit: respond once the tx's block is committed"),
+		qparam("timeout", "string", "how long wait=commit waits, a duration e.g. 90s"),
+	}
+	heightDesc := "a block height"
+
+	return []apiRoute{
+		{Path: "/tx", Handler: cepTx, Summary: "submit a transaction", Params: txParams,
+			Body: txReq{}, Form: true, Legacy: true,
+			Resps: with(map[int]apiResp{
+				http.StatusCreated:        {Desc: "added (txState if wait=commit)", Body: oneOf{txStruct{}, txState{}}},
+				http.StatusBadRequest:     respTxBadReq,
+				http.StatusGatewayTimeout: {Desc: "wait=commit timed out, tx still pending", Body: txState{}},
+			}, respTxRejects)},
+		// registered before /tx/{id} which would also match it.
+		{Path: "/tx/batch", Methods: post, Handler: cepTxBatch, Summary: "submit a batch of transactions",
+			Body: batchReq{},
+			Resps: map[int]apiResp{
+				http.StatusCreated:              {Desc: "all added", Body: batchResult{}},
+				http.StatusMultiStatus:          {Desc: "some added", Body: batchResult{}},
+				http.StatusBadRequest:           {Desc: "invalid body or none added", Body: oneOf{batchResult{}, errStruct{}, cerrEnvelope{}}},
+				http.StatusUnsupportedMediaType: {Desc: "unsupported content type", Body: cerrEnvelope{}},
+			}},
+		{Path: "/tx/{id}", Methods: get, Handler: cepTxID, Summary: "a transaction and its status",
+			Params: []apiParam{pparam("id", "tx ID")},
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "found", Body: txState{}},
+				http.StatusBadRequest: respBadReq, http.StatusNotFound: respNotFound}},
+		{Path: "/searchtx", Handler: cepSearchTx, Summary: "committed and pending transactions of a key",
+			Params: []apiParam{qparam("key", "string", "key to search for")}, Legacy: true,
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "found", Body: searchResult{}}, http.StatusBadRequest: respBadReq}},
+		{Path: "/proof", Handler: cepProof, Summary: "merkle inclusion proof of a committed transaction",
+			Params: []apiParam{qparam("id", "string", "tx ID")},
+			Resps: map[int]apiResp{
+				http.StatusOK:                  {Desc: "proof", Body: merkleProof{}},
+				http.StatusBadRequest:          respBadReq,
+				http.StatusNotFound:            {Desc: "not found", Body: errStruct{}},
+				http.StatusConflict:            {Desc: "block predates merkle roots", Body: errStruct{}},
+				http.StatusInternalServerError: {Desc: "proof failed", Body: cerrEnvelope{}},
+			}},
+		{Path: "/pending", Methods: get, Handler: cepPending, Summary: "the pending (uncommitted) block",
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "pending block", Body: pendingInfo{}}}},
+		{Path: "/events", Methods: get, Handler: cepEvents, Summary: "server-sent events of committed blocks (event block, id height)",
+			Params: []apiParam{{Name: "Last-Event-ID", In: "header", Type: "integer", Desc: "resume after this block height"}},
+			Resps: map[int]apiResp{
+				http.StatusOK:         {Desc: "event stream, each event's data is a blkLoc", Body: blkLoc{}, CType: "text/event-stream"},
+				http.StatusBadRequest: respBadReq,
+			}},
+		// registered before /keys/{key:.+} which would also match its paths.
+		{Path: "/keys/{key:.+}/history", Methods: get, Handler: cepKeyHistory, Summary: "committed transactions of a key",
+			Params: []apiParam{pparam("key", "key, may contain '/'"),
+				qparam("order", "string", "asc (default) or desc"),
+				qparam("since", "string", "RFC3339 time, inclusive"),
+				qparam("until", "string", "RFC3339 time, exclusive"),
+				qparam("limit", "integer", "page size"),
+				qparam("cursor", "string", "next of the previous page (opaque)")},
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "page", Body: keyHistPage{}}, http.StatusBadRequest: respBadReq}},
+		{Path: "/keys/{key:.+}", Methods: get, Handler: cepKey, Summary: "latest or point-in-time value of a key",
+			Params: []apiParam{pparam("key", "key, may contain '/'; one ending in /history is read via /searchtx"),
+				qparam("at", "string", "block height or RFC3339 time (of block commits) to read the value as of"),
+				qparam("pending", "boolean", "include pending writes")},
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "value", Body: keyValue{}},
+				http.StatusBadRequest: respBadReq, http.StatusNotFound: respNotFound}},
+		{Path: "/blocks", Methods: get, Handler: cepBlocks, Summary: "committed blocks in height order",
+			Params: []apiParam{qparam("from", "integer", heightDesc), qparam("limit", "integer", "page size")},
+			Resps:  map[int]apiResp{http.StatusOK: {Desc: "page", Body: blksPage{}}, http.StatusBadRequest: respBadReq}},
+		{Path: "/blocks/head", Methods: get, Handler: cepBlockHead, Summary: "the last committed block",
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "block", Body: blkLoc{}}, http.StatusNotFound: {Desc: "no blocks", Body: errStruct{}}}},
+		{Path: "/blocks/height/{n:[0-9]+}", Methods: get, Handler: cepBlockHeight, Summary: "a committed block by height",
+			Params: []apiParam{pparam("n", heightDesc)},
+			Resps:  map[int]apiResp{http.StatusOK: {Desc: "block", Body: blkLoc{}}, http.StatusNotFound: {Desc: "not found", Body: errStruct{}}}},
+		{Path: "/blocks/{hash:[0-9a-f]{64}}", Methods: get, Handler: cepBlockHash, Summary: "a committed block by hash",
+			Params: []apiParam{pparam("hash", "block hash")},
+			Resps:  map[int]apiResp{http.StatusOK: {Desc: "block", Body: blkLoc{}}, http.StatusNotFound: {Desc: "not found", Body: errStruct{}}}},
+		{Path: "/clock/advance", Handler: cepClockAdvance, Summary: "advance the fake clock (-clock.fake)",
+			Params:  []apiParam{qparam("d", "string", "duration e.g. 1m30s")},
+			Enabled: func() bool { _, ok := clk.(*fakeClock); return ok },
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "new time", Body: struct {
+				Now   time.Time `json:"now"`
+				NowNs int64     `json:"nowns"`
+			}{}}, http.StatusBadRequest: respBadReq}},
+		{Path: "/admin/commit", Methods: post, Handler: cepAdminCommit, Summary: "commit the pending block now",
+			Enabled: func() bool { return srvadminenable },
+			Resps:   map[int]apiResp{http.StatusOK: {Desc: "what was done", Body: adminResult{}}}},
+		{Path: "/admin/pause", Methods: post, Handler: cepAdminPause, Summary: "pause block commits",
+			Enabled: func() bool { return srvadminenable },
+			Resps:   map[int]apiResp{http.StatusOK: {Desc: "what was done", Body: adminResult{}}}},
+		{Path: "/admin/resume", Methods: post, Handler: cepAdminResume, Summary: "resume block commits",
+			Enabled: func() bool { return srvadminenable },
+			Resps:   map[int]apiResp{http.StatusOK: {Desc: "what was done", Body: adminResult{}}}},
+		{Path: "/srvshutdown", Handler: cepSrvShutdown, Summary: "shut the server down",
+			Legacy: true, Enabled: func() bool { return srvsdenable },
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "shutting down", Body: struct {
+				ClientMsg string `json:"clientmsg"`
+			}{}}}},
+		{Path: "/openapi.json", Methods: get, Handler: cepOpenAPI, Summary: "this OpenAPI document",
+			Resps: map[int]apiResp{http.StatusOK: {Desc: "OpenAPI 3 document", Body: map[string]interface{}{}}}},
+	}
+}
+
+// deprecated - wraps h of an unversioned alias to tell clients of its successor.
+func deprecated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiPrefix+r.URL.Path+">; rel=\"successor-version\"")
+		h(w, r)
+	}
+}
+
+// registerRoutes - registers the enabled routes of the api route table on r,
+// returns them.
+func registerRoutes(r *mux.Router) []apiRoute {
+	var routes []apiRoute
+	for _, rt := range apiRoutes() {
+		if rt.Enabled != nil && !rt.Enabled() {
+			continue
+		}
+		mr := r.HandleFunc(apiPrefix+rt.Path, rt.Handler)
+		if rt.Methods != nil {
+			mr.Methods(rt.Methods...)
+		}
+		if rt.Legacy {
+			mr = r.HandleFunc(rt.Path, deprecated(rt.Handler))
+			if rt.Methods != nil {
+				mr.Methods(rt.Methods...)
+			}
+		}
+		routes = append(routes, rt)
+	}
+	return routes
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// this file contains functions related to ed25519 signed transactions.
+
+// canonBytes - returns an unambiguous encoding of 'fields': each field is
+// preceded by its length as an 8 byte big endian integer.
+func canonBytes(fields ...string) []byte {
+	var n int
+	for _, f := range fields {
+		n += 8 + len(f)
+	}
+	buf := make([]byte, 0, n)
+	for _, f := range fields {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(f)))
+		buf = append(buf, l[:]...)
+		buf = append(buf, f...)
+	}
+	return buf
+}
+
+// signBytes - returns the canonical tx bytes a client signs: Key, Value,
+// PrevID (the ID of the key's last tx, "" if none), Delegate if set and Meta
+// if set (as json with sorted keys, as in computeID); the TimeStamp is set by
+// the server so is not part of it. PrevID binds the signature to the key's
+// state, so once the key is written again (including by the tx itself) the
+// signature can not be replayed, see checkPrevll.
+func (tx *txStruct) signBytes() []byte {
+	fields := []string{"blkchain-tx", tx.Key, tx.Value, "previd", tx.PrevID}
+	if tx.Delegate != "" {
+		fields = append(fields, "delegate", tx.Delegate)
+	}
+	if len(tx.Meta) > 0 {
+		// json.Marshal sorts map keys so the encoding is canonical.
+		meta, err := json.Marshal(tx.Meta)
+		if err != nil {
+			return nil
+		}
+		fields = append(fields, "meta", string(meta))
+	}
+	return canonBytes(fields...)
+}
+
+// lastIDll - returns the ID of the last tx for 'key': of 'batch' (may be
+// nil), pending in blk or committed, "" if none; expects bcmu.Lock mutex to
+// be active.
+func lastIDll(key string, batch *batchSeen) string {
+	if batch != nil {
+		if id, ok := batch.last[key]; ok {
+			return id
+		}
+	}
+	for i := len(blk.Transactions) - 1; i >= 0; i-- {
+		if blk.Transactions[i].Key == key {
+			return blk.Transactions[i].ID
+		}
+	}
+	id, _ := lookupKeyLastID(key)
+	return id
+}
+
+// checkPrevll - checks a signed tx's PrevID is the ID of its key's last tx,
+// rejecting a replayed or stale signature; expects bcmu.Lock mutex to be active.
+func checkPrevll(tx *txStruct, batch *batchSeen) *txErr {
+	if tx.Sig == "" {
+		return nil
+	}
+	if last := lastIDll(tx.Key, batch); tx.PrevID != last {
+		return &txErr{http.StatusConflict, ErrTxPrevID,
+			fmt.Sprintf("key %q: previd=%q is not the ID of its last tx %q; re-sign with it", tx.Key, tx.PrevID, last)}
+	}
+	return nil
+}
+
+// checkSig - checks the tx's PubKey and Sig (both hexed), an unsigned tx is
+// accepted unless -tx.requiresig or it sets a Delegate or PrevID.
+func (tx *txStruct) checkSig() *txErr {
+	if tx.PubKey == "" && tx.Sig == "" {
+		if txrequiresig || tx.Delegate != "" || tx.PrevID != "" {
+			return &txErr{http.StatusUnauthorized, ErrTxSigMissing, "transaction must be signed (pubkey and sig)"}
+		}
+		return nil
+	}
+
+	pub, err := hex.DecodeString(tx.PubKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return &txErr{http.StatusBadRequest, ErrTxSigMalformed,
+			fmt.Sprintf("pubkey must be %d hexed bytes; pubkey=%q", ed25519.PublicKeySize, tx.PubKey)}
+	}
+	sig, err := hex.DecodeString(tx.Sig)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return &txErr{http.StatusBadRequest, ErrTxSigMalformed,
+			fmt.Sprintf("sig must be %d hexed bytes; sig=%q", ed25519.SignatureSize, tx.Sig)}
+	}
+	if d, err := hex.DecodeString(tx.Delegate); err != nil || (tx.Delegate != "" && len(d) != ed25519.PublicKeySize) {
+		return &txErr{http.StatusBadRequest, ErrTxSigMalformed,
+			fmt.Sprintf("delegate must be %d hexed bytes; delegate=%q", ed25519.PublicKeySize, tx.Delegate)}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), tx.signBytes(), sig) {
+		return &txErr{http.StatusForbidden, ErrTxSigInvalid, "sig does not verify with pubkey"}
+	}
+	return nil
+}
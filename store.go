@@ -0,0 +1,441 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains the block storage backends (-blk.store).
+
+// blkStore - where committed blocks are kept. Methods other than open, close
+// and readBlk expect bcmu.Lock mutex to be active.
+type blkStore interface {
+	// open - opens (creating if needed) the store, repairing what a hard
+	// killed process may have left behind.
+	open() error
+	// appendBlk - appends block 'b', first is true for the first block
+	// appended during invocation 'inv'; returns where b is and bytes written.
+	appendBlk(inv string, first bool, b *Blk) (blkPos, int, error)
+	// closeInv - ends this invocation's blocks, called at exit if any block
+	// was appended; returns bytes written.
+	closeInv() (int, error)
+	// scanBlks - calls fn with each block in the store in chain order, its
+	// invocation and where it is; open is true if blocks were appended during
+	// this invocation and closeInv has not been called yet.
+	scanBlks(open bool, fn func(inv string, b *Blk, pos blkPos) error) error
+	// readBlk - returns the block at 'pos' (from appendBlk or scanBlks), safe
+	// to call concurrently with the other methods.
+	readBlk(pos blkPos) (Blk, error)
+	// headHash - returns the hash of the last block or "" if there are none.
+	headHash() (string, error)
+	// sync - commits appended blocks to stable storage (fsync).
+	sync() error
+	// size - returns the bytes used by the store.
+	size() int64
+	close() error
+}
+
+// blkPos - where a block is in a blkStore: its segment (segStore) and the
+// offset and length of its json; for memStore off is the block's index.
+type blkPos struct {
+	seg int
+	off int64
+	len int64
+}
+
+// blkStores - available -blk.store values.
+var blkStores = map[string]func() blkStore{
+	"file": newFileStore,
+	"mem":  newMemStore,
+	"seg":  newSegStore,
+}
+
+// memStore - blkStore backend keeping blocks in memory only, for tests and
+// simulations; nothing is kept after exit.
+type memStore struct {
+	mu    sync.RWMutex // guards blks for readBlk.
+	blks  []memBlk
+	nbyte int64 // json size of the blocks.
+}
+
+// memBlk - a block of a memStore and its invocation.
+type memBlk struct {
+	inv string
+	b   Blk
+}
+
+func newMemStore() blkStore {
+	return &memStore{}
+}
+
+func (s *memStore) open() error {
+	return nil
+}
+
+func (s *memStore) appendBlk(inv string, first bool, b *Blk) (blkPos, int, error) {
+	bdata, err := json.Marshal(b)
+	if err != nil {
+		return blkPos{}, 0, err
+	}
+	mb := memBlk{inv: inv, b: *b}
+	mb.b.Transactions = append([]txStruct(nil), b.Transactions...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blks = append(s.blks, mb)
+	s.nbyte += int64(len(bdata))
+	return blkPos{off: int64(len(s.blks) - 1)}, len(bdata), nil
+}
+
+func (s *memStore) closeInv() (int, error) {
+	return 0, nil
+}
+
+func (s *memStore) scanBlks(open bool, fn func(inv string, b *Blk, pos blkPos) error) error {
+	for i := range s.blks {
+		b := s.blks[i].b
+		if err := fn(s.blks[i].inv, &b, blkPos{off: int64(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) readBlk(pos blkPos) (Blk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if pos.off < 0 || pos.off >= int64(len(s.blks)) {
+		return Blk{}, fmt.Errorf("memstore: no block %d", pos.off)
+	}
+	return s.blks[pos.off].b, nil
+}
+
+func (s *memStore) headHash() (string, error) {
+	if n := len(s.blks); n > 0 {
+		return s.blks[n-1].b.BlockHash, nil
+	}
+	return "", nil
+}
+
+func (s *memStore) sync() error {
+	return nil
+}
+
+func (s *memStore) size() int64 {
+	return s.nbyte
+}
+
+func (s *memStore) close() error {
+	return nil
+}
+
+// segStore - blkStore backend keeping blocks as a series of segment files of
+// -blk.format, listed in order by a manifest which records the PrevHash of each
+// segment's first block. Segments rotate at a block boundary once the current
+// one reaches maxbytes and, if perInv, at the start of each invocation.
+type segStore struct {
+	dir      string             // directory of the manifest and segments.
+	manifest string             // manifest file name.
+	segName  func(i int) string // file name of the i'th (from 1) segment.
+	perInv   bool
+	maxbytes int64 // <1 =off.
+	fmt      blkFormat
+	mu       sync.RWMutex // guards segs for readBlk.
+	segs     []segEntry
+	cur      *fileStore // segment being appended to, nil until this invocation's first block.
+	curfirst bool       // true until cur has a block from this invocation.
+	head     string     // hash of the last block, valid if headok.
+	headok   bool
+}
+
+// segEntry - a segment in a manifest.
+type segEntry struct {
+	File     string `json:"file"`            // relative to the manifest's directory.
+	PrevHash string `json:"prev-block-hash"` // PrevHash of the segment's first block.
+}
+
+// segManifest - the manifest of a segStore.
+type segManifest struct {
+	Segments []segEntry `json:"segments"`
+}
+
+// newSegStore - -blk.store=seg: segments seg-000001.json, ... in -blk.segdir, a
+// new one each invocation.
+func newSegStore() blkStore {
+	ext := blkfmt.ext()
+	return &segStore{dir: blksegdir, manifest: "manifest.json", perInv: true,
+		maxbytes: blksegmaxbytes, fmt: blkfmt,
+		segName: func(i int) string { return fmt.Sprintf("seg-%06d%s", i, ext) }}
+}
+
+// newRotFileStore - -blk.store=file with -blk.segmaxbytes: blkfile (e.g.
+// blkchain.json) is the first segment followed by blkchain-000002.json, ...
+// and manifest blkchain-manifest.json.
+func newRotFileStore() blkStore {
+	ext := filepath.Ext(blkfile)
+	base := strings.TrimSuffix(filepath.Base(blkfile), ext)
+	return &segStore{dir: filepath.Dir(blkfile), manifest: base + "-manifest.json",
+		maxbytes: blksegmaxbytes, fmt: blkfmt,
+		segName: func(i int) string {
+			if i == 1 {
+				return filepath.Base(blkfile)
+			}
+			return fmt.Sprintf("%s-%06d%s", base, i, ext)
+		}}
+}
+
+func (s *segStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// loadManifest - reads the manifest, if there is none yet the segments that
+// exist are listed in a new one (e.g. a blkfile written before rotation).
+func (s *segStore) loadManifest() error {
+	var m segManifest
+	data, err := ioutil.ReadFile(s.path(s.manifest))
+	if err == nil {
+		if err = json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("manifest:%q %v", s.manifest, err)
+		}
+		s.segs = m.Segments
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	prev := genesisPrevHash
+	for i := 1; ; i++ {
+		name := s.segName(i)
+		if _, err = os.Stat(s.path(name)); err != nil {
+			break
+		}
+		e := segEntry{File: name, PrevHash: prev}
+		first := true
+		err = (&fileStore{name: s.path(name), fmt: s.fmt}).scanBlks(false, func(inv string, b *Blk, pos blkPos) error {
+			if first {
+				e.PrevHash, first = b.PrevHash, false
+			}
+			prev = b.BlockHash
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("segment:%q %v", name, err)
+		}
+		s.segs = append(s.segs, e)
+	}
+	if len(s.segs) == 0 {
+		return nil
+	}
+	return s.writeManifest()
+}
+
+// writeManifest - replaces the manifest via a rename so it is never partially
+// written; the new manifest is synced before the rename and the rename is
+// synced via its directory so a crash leaves the old or the new one.
+func (s *segStore) writeManifest() error {
+	data, err := json.MarshalIndent(segManifest{s.segs}, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(s.manifest + ".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path(s.manifest)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// syncDir - syncs directory 'dir' so the files created or renamed in it persist.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *segStore) open() error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if err := s.loadManifest(); err != nil {
+		return err
+	}
+
+	// only the last segment could have been left behind by a hard killed process.
+	var err error
+	if n := len(s.segs); n > 0 {
+		last := &fileStore{name: s.path(s.segs[n-1].File), fmt: s.fmt}
+		err = last.open()
+		if cerr := last.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openSeg - opens the last segment to append to or, if there is none or it
+// may not be used, adds a new segment whose first block will be 'b'.
+func (s *segStore) openSeg(b *Blk) error {
+	n := len(s.segs)
+	if s.perInv || n == 0 || s.full(s.path(s.segs[n-1].File)) {
+		// the manifest lists the segment before it is written to, so a
+		// listed segment is at worst empty.
+		s.mu.Lock()
+		s.segs = append(s.segs, segEntry{File: s.segName(n + 1), PrevHash: b.PrevHash})
+		s.mu.Unlock()
+		if err := s.writeManifest(); err != nil {
+			s.mu.Lock()
+			s.segs = s.segs[:n]
+			s.mu.Unlock()
+			return err
+		}
+		n++
+		fn.LogCondMsg(verblvl > 1, fmt.Sprintf("blkstore: new segment:%q\n", s.segs[n-1].File))
+	}
+	s.cur = &fileStore{name: s.path(s.segs[n-1].File), fmt: s.fmt}
+	s.curfirst = true
+	if err := s.cur.open(); err != nil {
+		return err
+	}
+	// the segment may have just been created.
+	return syncDir(s.dir)
+}
+
+// full - returns true if segment file 'name' reached maxbytes.
+func (s *segStore) full(name string) bool {
+	return s.maxbytes > 0 && (&fileStore{name: name}).size() >= s.maxbytes
+}
+
+func (s *segStore) appendBlk(inv string, first bool, b *Blk) (blkPos, int, error) {
+	// rotate at this block boundary if the current segment is full.
+	if s.cur != nil && s.full(s.cur.name) {
+		if _, err := s.cur.closeInv(); err != nil {
+			return blkPos{}, 0, err
+		}
+		// sync the full segment, later syncs only sync the new one.
+		if err := s.cur.sync(); err != nil {
+			return blkPos{}, 0, err
+		}
+		if err := s.cur.close(); err != nil {
+			return blkPos{}, 0, err
+		}
+		s.cur = nil
+	}
+	if s.cur == nil {
+		if err := s.openSeg(b); err != nil {
+			s.cur = nil
+			return blkPos{}, 0, err
+		}
+	}
+
+	pos, n, err := s.cur.appendBlk(inv, first || s.curfirst, b)
+	pos.seg = len(s.segs) - 1
+	if err == nil {
+		s.curfirst = false
+		s.head, s.headok = b.BlockHash, true
+	}
+	return pos, n, err
+}
+
+func (s *segStore) closeInv() (int, error) {
+	if s.cur == nil {
+		return 0, nil
+	}
+	return s.cur.closeInv()
+}
+
+func (s *segStore) scanBlks(open bool, fn func(inv string, b *Blk, pos blkPos) error) error {
+	head := ""
+	for i, e := range s.segs {
+		seg := fileStore{name: s.path(e.File), fmt: s.fmt}
+		err := seg.scanBlks(open && s.cur != nil && seg.name == s.cur.name, func(inv string, b *Blk, pos blkPos) error {
+			pos.seg = i
+			head = b.BlockHash
+			return fn(inv, b, pos)
+		})
+		if err != nil {
+			return fmt.Errorf("segment:%q %v", e.File, err)
+		}
+	}
+	s.head, s.headok = head, true
+	return nil
+}
+
+func (s *segStore) readBlk(pos blkPos) (Blk, error) {
+	s.mu.RLock()
+	if pos.seg < 0 || pos.seg >= len(s.segs) {
+		s.mu.RUnlock()
+		return Blk{}, fmt.Errorf("segstore: no segment %d", pos.seg)
+	}
+	name := s.path(s.segs[pos.seg].File)
+	s.mu.RUnlock()
+
+	f, err := os.Open(name)
+	if err != nil {
+		return Blk{}, err
+	}
+	defer func() { _ = f.Close() }()
+	return readBlkAt(f, pos)
+}
+
+func (s *segStore) headHash() (string, error) {
+	if !s.headok {
+		if err := s.scanBlks(false, func(string, *Blk, blkPos) error { return nil }); err != nil {
+			return "", err
+		}
+	}
+	return s.head, nil
+}
+
+func (s *segStore) sync() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.sync()
+}
+
+func (s *segStore) size() int64 {
+	var size int64
+	for _, e := range s.segs {
+		if fi, err := os.Stat(s.path(e.File)); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+func (s *segStore) close() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.close()
+}
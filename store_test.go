@@ -0,0 +1,116 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSegStore(t *testing.T) {
+	doc := testBlocks(t, 6, 2)
+	blocks := doc[0].Blocks
+
+	tests := []struct {
+		name     string
+		perInv   bool
+		maxbytes int64
+		invs     []int // blocks appended by each invocation.
+		segs     int
+		rebuild  bool // remove the manifest before reopening.
+	}{
+		{"no rotation", false, 0, []int{2, 3, 1}, 1, false},
+		{"per invocation", true, 0, []int{2, 3, 1}, 3, false},
+		{"rotated by size", false, 1, []int{2, 3, 1}, 6, false},
+		{"rebuilt per invocation", true, 0, []int{2, 3, 1}, 3, true},
+		{"rebuilt rotated by size", false, 1, []int{2, 3, 1}, 6, true},
+	}
+
+	top, err := ioutil.TempDir("", "blkchain-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(top) }()
+
+	for fi, bf := range []blkFormat{jsonFormat{}, jsonlFormat{}} {
+		for ti, tc := range tests {
+			name := bf.ext() + " " + tc.name
+			dir := filepath.Join(top, fmt.Sprintf("%d-%d", fi, ti))
+			// newStore - returns the store as an invocation opens it.
+			newStore := func() *segStore {
+				s := &segStore{dir: dir, manifest: "manifest.json", perInv: tc.perInv, maxbytes: tc.maxbytes, fmt: bf,
+					segName: func(i int) string { return fmt.Sprintf("seg-%06d%s", i, bf.ext()) }}
+				if err := s.open(); err != nil {
+					t.Fatalf("%s: open err:%v", name, err)
+				}
+				return s
+			}
+
+			next := 0
+			for inv, n := range tc.invs {
+				s := newStore()
+				for i := 0; i < n; i++ {
+					if _, _, err = s.appendBlk(fmt.Sprintf("invts-%d", inv), i == 0, &blocks[next]); err != nil {
+						t.Fatalf("%s: appendBlk err:%v", name, err)
+					}
+					next++
+				}
+				if _, err = s.closeInv(); err != nil {
+					t.Fatalf("%s: closeInv err:%v", name, err)
+				}
+				if err = s.close(); err != nil {
+					t.Fatalf("%s: close err:%v", name, err)
+				}
+			}
+
+			manifest := filepath.Join(dir, "manifest.json")
+			s := newStore()
+			want := fmt.Sprint(s.segs)
+			if tc.rebuild {
+				if err = os.Remove(manifest); err != nil {
+					t.Fatal(err)
+				}
+				s = newStore()
+				if got := fmt.Sprint(s.segs); got != want {
+					t.Errorf("%s: rebuilt manifest %s want %s", name, got, want)
+				}
+			}
+			if len(s.segs) != tc.segs {
+				t.Errorf("%s: %d segments want %d", name, len(s.segs), tc.segs)
+			}
+
+			// each segment's first block links to its manifest entry's PrevHash.
+			var hashes []string
+			first := -1
+			err = s.scanBlks(false, func(inv string, b *Blk, pos blkPos) error {
+				if pos.seg != first {
+					first = pos.seg
+					if b.PrevHash != s.segs[pos.seg].PrevHash {
+						t.Errorf("%s: segment %d first prev hash %s manifest %s", name, pos.seg,
+							b.PrevHash, s.segs[pos.seg].PrevHash)
+					}
+				}
+				rb, rerr := s.readBlk(pos)
+				if rerr != nil || rb.BlockHash != b.BlockHash {
+					t.Errorf("%s: readBlk %+v hash %s err:%v want %s", name, pos, rb.BlockHash, rerr, b.BlockHash)
+				}
+				hashes = append(hashes, b.BlockHash)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("%s: scanBlks err:%v", name, err)
+			}
+			if len(hashes) != len(blocks) || hashes[len(hashes)-1] != blocks[len(blocks)-1].BlockHash {
+				t.Errorf("%s: scanned %d blocks want %d", name, len(hashes), len(blocks))
+			}
+			if msg, excode := verifyBlkfile(manifest); excode != ExcodeNoError {
+				t.Errorf("%s: %s", name, msg)
+			}
+		}
+	}
+}
@@ -6,10 +6,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
@@ -30,25 +32,55 @@ import (
 var (
 	blkctime        time.Duration
 	blkctimestr     string
+	blkfmt          blkFormat
+	blkstorename    string
 	blktxmax        int
 	blkfile         string
-	blkfilep        *os.File
+	blksegdir       string
+	blksegmaxbytes  int64
+	blkstore        blkStore
 	devMode         bool
 	expvars         bool
 	fnlogflags      int
-	openingFileSize int64 // opening 'blockchain' file size
+	openingFileSize int64 // opening 'blockchain' store size
+	srvadminenable  bool
 	srvsdenable     bool
+	txdupmode       string
+	txhashver       int
+	txownership     bool
+	txrequiresig    bool
 	srvurl          string
 	srvport         int
 	timeofinv       time.Time // time of invocation
 	verblvl         int
+	verifyfile      string
 )
 
 type txStruct struct {
-	ID        string `json:"id"` // 64 len hexstring of sha256.
-	Key       string `json:"key"`
-	Value     string `json:"value"`
-	TimeStamp int64  `json:"timestamp"`
+	ID          string `json:"id"` // 64 len hexstring of sha256.
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	TimeStamp   int64  `json:"timestamp"`             // unix seconds.
+	TimeStampNs int64  `json:"timestampns,omitempty"` // unix nanoseconds, same time as TimeStamp.
+	PubKey      string `json:"pubkey,omitempty"`      // hexed ed25519 public key of signer.
+	Sig         string `json:"sig,omitempty"`         // hexed ed25519 signature of signBytes.
+	Delegate    string `json:"delegate,omitempty"`    // hexed pubkey the key's owner authorizes, see owner.go
+	PrevID      string `json:"previd,omitempty"`      // ID of the key's last tx when signed, see sig.go
+	HashVer     int    `json:"hashver,omitempty"`     // how ID was computed, see computeID.
+	Nonce       uint64 `json:"nonce,omitempty"`       // set to make a duplicate's ID unique, see dup.go
+	// Meta - client metadata, part of the ID and of signBytes.
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// txErr - why a transaction was rejected.
+type txErr struct {
+	scode int // http status code.
+	code  int // error code (see ecodes.go).
+	msg   string
+}
+
+func (e *txErr) Error() string {
+	return e.msg
 }
 
 type errStruct struct {
@@ -57,11 +89,18 @@ type errStruct struct {
 
 // Blk - block struct
 type Blk struct {
-	PrevHash     string     `json:"prev-block-hash"` // 64 len hexstring of sha256
-	BlockHash    string     `json:"block-hash"`      // 64 len hexstring of sha256
+	HashVer      int        `json:"hashver,omitempty"`     // how BlockHash was computed, see computeHash.
+	Height       uint64     `json:"height"`                // position in the chain, genesis is 0.
+	TimeStampNs  int64      `json:"timestampns,omitempty"` // unix nanoseconds the block was committed.
+	PrevHash     string     `json:"prev-block-hash"`       // 64 len hexstring of sha256
+	BlockHash    string     `json:"block-hash"`            // 64 len hexstring of sha256
+	MerkleRoot   string     `json:"merkle-root,omitempty"` // 64 len hexstring, see merkle.go
 	Transactions []txStruct `json:"transactions"`
 }
 
+// genesisPrevHash - PrevHash of the first block in a blockchain.
+var genesisPrevHash = strings.Repeat("0", 64) // length of hexed sha256hash
+
 var (
 	bcmu            sync.Mutex // block chain mutex
 	blk             Blk        // a single block in a block chain
@@ -69,82 +108,103 @@ var (
 	totblkappSinv   uint64     // use with atomic total blocks appended to file since invocation
 	tottxappSinv    uint64     // use with atomic total transactions appended to file since invocation
 	totwrtbytesSinv uint64     // use with atomic total bytes written to file since invocation
+	blkstart        time.Time  // when blk got its first transaction, guarded by bcmu.
+	flushdue        time.Time  // when flushtimer will commit blk, zero if not set; guarded by bcmu.
 )
 
-// expects bcmu.Lock mutext to be active
-func (b *Blk) append2File() {
-	defer fn.LogCondTrace(verblvl > 1)()
+// hexSha256 - returns the 64 len hexstring of the sha256 of data.
+func hexSha256(data []byte) string {
+	src := sha256.Sum256(data)
+	return hex.EncodeToString(src[:])
+}
 
-	// check if Transactions were already written, could happen because of timer.
-	if b.Transactions == nil {
-		return
-	}
+// block hash versions (Blk.HashVer).
+const (
+	blkHashVerLegacy = 0 // sha256 of PrevHash and the tx IDs concatenated; no height, time or merkle root.
+	blkHashVerCanon  = 1 // sha256 of canonBytes of the block header, see hdrHash.
+)
 
-	// compute the current block hash
-	var buf bytes.Buffer
-	// if first block during this [program] invocation.
-	if totblkappSinv == 0 {
-		b.PrevHash = strings.Repeat("0", 64) // length of hexed sha256hash
+// computeHash - returns the block hash according to the block's HashVer, ""
+// if unknown.
+func (b *Blk) computeHash() string {
+	if b.HashVer != blkHashVerLegacy {
+		return b.hdrHash(len(b.Transactions))
 	}
+	var buf bytes.Buffer
 	buf.WriteString(b.PrevHash)
 	for i := 0; i < len(b.Transactions); i++ {
-		buf.Write([]byte(b.Transactions[i].ID[:]))
+		buf.WriteString(b.Transactions[i].ID)
 	}
-	src := sha256.Sum256(buf.Bytes())
-	dst := make([]byte, hex.EncodedLen(len(src)))
-	hex.Encode(dst, src[:])
-	b.BlockHash = string(dst[:])
+	return hexSha256(buf.Bytes())
+}
 
-	bytes1, jerr := json.Marshal(b)
-	if jerr != nil {
-		logPanic("json.Marshal:" + jerr.Error()) // TODO later better error msg even though should not happen :)
+// hdrHash - returns the hash of the header of a block of 'txcnt' transactions
+// for a HashVer that commits to the txs via MerkleRoot, "" if unknown; so a
+// merkle proof can be checked without the block's transactions.
+func (b *Blk) hdrHash(txcnt int) string {
+	switch b.HashVer {
+	case blkHashVerCanon:
+		return hexSha256(canonBytes("blkchain-blk", "1", fmt.Sprintf("%d", b.Height),
+			fmt.Sprintf("%d", b.TimeStampNs), b.PrevHash, b.MerkleRoot, fmt.Sprintf("%d", txcnt)))
+	}
+	return ""
+}
+
+// expects bcmu.Lock mutext to be active
+func (b *Blk) append2File() {
+	defer fn.LogCondTrace(verblvl > 1)()
+
+	// check if Transactions were already written, could happen because of timer.
+	if b.Transactions == nil {
 		return
 	}
 
-	// adjust json that is to be added to blockchain file.
-	var buf1 bytes.Buffer
-	// if first block
-	if totblkappSinv == 0 {
-		// adjust stuff to make file json parse-able as well as making invocation name contain epoch-ts..
-		if blkchainFileSize() == 0 {
-			buf1.Write([]byte("{"))
-		} else {
-			// TODO verify '}' is last char in file probably should do at open time.
-			// need to replace last char which must be and is assumed to be '}' in file with a ',' and add linefeed.
-			n, err := blkfilep.Seek(blkchainFileSize()-1, os.SEEK_SET)
-			if err != nil {
-				logPanic(err)
-			}
-			if n != blkchainFileSize()-1 {
-				logPanic(err)
-			}
-			buf1.Write([]byte(`,` + "\n"))
-		}
-		inv := fmt.Sprintf(`"invts-%d":[`, timeofinv.Unix())
-		buf1.Write([]byte(inv))
-	} else {
-		buf1.Write([]byte(`,` + "\n"))
+	var err error
+	if b.MerkleRoot, err = b.computeMerkleRoot(); err != nil {
+		logPanic(err)
 	}
+	b.HashVer = blkHashVerCanon
+	b.Height = chainLen()
+	b.TimeStampNs = clk.Now().UnixNano()
+	b.BlockHash = b.computeHash()
 
-	// write it to the blockchain file.
-	buf1.Write(bytes1)
-	bytes2 := buf1.Bytes()
-	if _, err := blkfilep.Write(bytes2); err != nil {
+	// write it to the block store.
+	pos, n, err := blkstore.appendBlk(invName(), totblkappSinv == 0, b)
+	if err != nil {
 		logPanic("appendWriteError:" + err.Error())
 	}
+	// a committed block is durable before anyone is told of it (see wait.go).
+	if err = blkstore.sync(); err != nil {
+		logPanic("syncError:" + err.Error())
+	}
 
-	fn.LogCondMsg(verblvl > 2, fmt.Sprintf("curblkwrtbytes:%d BlockHash:%v", len(bytes2), b.BlockHash))
+	fn.LogCondMsg(verblvl > 2, fmt.Sprintf("curblkwrtbytes:%d BlockHash:%v", n, b.BlockHash))
+	if err = indexBlk(invName(), b, pos); err != nil {
+		logPanic(err)
+	}
+	notifyBlk()
 
 	// update counters.
 	atomic.AddUint64(&totblkappSinv, 1)
 	atomic.AddUint64(&tottxappSinv, uint64(len(b.Transactions)))
-	atomic.AddUint64(&totwrtbytesSinv, uint64(len(bytes2)))
+	atomic.AddUint64(&totwrtbytesSinv, uint64(n))
 	atomic.StoreUint64(&curblktxcnt, 0)
 
 	// get ready for possible next block
 	b.Transactions = nil
 	b.PrevHash = b.BlockHash
 	b.BlockHash = ""
+	b.MerkleRoot = ""
+	b.HashVer = blkHashVerLegacy
+	b.Height = 0
+	b.TimeStampNs = 0
+	blkstart = time.Time{}
+	flushdue = time.Time{}
+}
+
+// invName - name of this invocation's group of blocks in blkfile.
+func invName() string {
+	return fmt.Sprintf("invts-%d", timeofinv.Unix())
 }
 
 func (b *Blk) flush() {
@@ -152,14 +212,26 @@ func (b *Blk) flush() {
 	bcmu.Lock()
 	defer bcmu.Unlock()
 
-	b.append2File()
+	b.commitll(true)
 }
 
-var flushtimer *time.Timer
+// timerFlush - flushtimer's commit of the block, none while commits are paused.
+func (b *Blk) timerFlush() {
+	defer fn.LogCondTrace(verblvl > 2)()
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	if !commitsPaused {
+		b.append2File()
+	}
+}
+
+var flushtimer blkTimer
 
 func (b *Blk) setTimerFlushBlk() {
 	defer fn.LogCondTrace(verblvl > 3)()
-	flushtimer = time.AfterFunc(blkctime, b.flush)
+	flushtimer = clk.AfterFunc(blkctime, b.timerFlush)
+	flushdue = clk.Now().Add(blkctime)
 }
 
 func stopTimerFlushBlkll() {
@@ -167,6 +239,7 @@ func stopTimerFlushBlkll() {
 	if flushtimer != nil {
 		flushtimer.Stop()
 	}
+	flushdue = time.Time{}
 }
 
 // version of 'stopTimerFlushBlk' which wraps call with bcmu (mutex).
@@ -177,16 +250,50 @@ func stopTimerFlushBlk() {
 	stopTimerFlushBlkll()
 }
 
-// add a tranaction to the current block if none init a new block.
-func (tx *txStruct) addToBlock() {
+// add a tranaction to the current block if none init a new block, unless
+// it is a duplicate or key ownership does not allow it.
+func (tx *txStruct) addToBlock() *txErr {
 	defer fn.LogCondTrace(verblvl > 2)()
 	bcmu.Lock()
 	defer bcmu.Unlock()
 
+	if terr := checkTxll(tx, nil); terr != nil {
+		return terr
+	}
+	appendTxll(tx)
+	return nil
+}
+
+// checkTxll - checks tx is not a duplicate (see checkDup) and key ownership
+// allows it, then applies its ownership; expects bcmu.Lock mutex to be active.
+func checkTxll(tx *txStruct, batch *batchSeen) *txErr {
+	if terr := checkDup(tx, batch); terr != nil {
+		return terr
+	}
+	if terr := checkOwner(tx, batch); terr != nil {
+		return terr
+	}
+	applyOwner(tx)
+	return nil
+}
+
+// appendTxll - appends tx to the current block, committing the block once it
+// has blktxmax transactions; expects bcmu.Lock mutex to be active.
+func appendTxll(tx *txStruct) {
 	blk.Transactions = append(blk.Transactions, *tx)
 	lenbc := len(blk.Transactions)
 	atomic.StoreUint64(&curblktxcnt, uint64(lenbc))
 
+	if lenbc == 1 {
+		blkstart = clk.Now()
+	}
+
+	// while commits are paused the block keeps collecting, adminDo("resume") in admin.go
+	// commits it when they resume.
+	if commitsPaused {
+		return
+	}
+
 	// if first transaction in a block and max transactions in a block is not 1.
 	if lenbc == 1 && blktxmax != 1 {
 		blk.setTimerFlushBlk()
@@ -204,67 +311,269 @@ func (tx *txStruct) addToBlock() {
 	}
 }
 
+// tx hash versions (txStruct.HashVer).
+const (
+	hashVerLegacy = 0 // sha256 of Key, Value and TimeStamp concatenated; ambiguous.
+	hashVerCanon  = 1 // sha256 of canonBytes of the tx fields.
+)
+
+// computeID - returns the tx ID according to the tx's HashVer, "" if unknown.
+// For hashVerCanon optional fields are added as name, value pairs only when
+// set, so a field added later leaves IDs of txs without it unchanged.
+func (tx *txStruct) computeID() string {
+	tim := fmt.Sprintf("%v", tx.TimeStamp)
+	switch tx.HashVer {
+	case hashVerLegacy:
+		return hexSha256([]byte(tx.Key + tx.Value + tim))
+	case hashVerCanon:
+		fields := []string{"blkchain-txid", "1", tx.Key, tx.Value, tim}
+		if tx.PubKey != "" {
+			fields = append(fields, "pubkey", tx.PubKey)
+		}
+		if tx.Delegate != "" {
+			fields = append(fields, "delegate", tx.Delegate)
+		}
+		if tx.PrevID != "" {
+			fields = append(fields, "previd", tx.PrevID)
+		}
+		if tx.Nonce != 0 {
+			fields = append(fields, "nonce", fmt.Sprintf("%d", tx.Nonce))
+		}
+		if tx.TimeStampNs != 0 {
+			fields = append(fields, "timestampns", fmt.Sprintf("%d", tx.TimeStampNs))
+		}
+		if len(tx.Meta) > 0 {
+			// json.Marshal sorts map keys so the encoding is canonical.
+			meta, err := json.Marshal(tx.Meta)
+			if err != nil {
+				return ""
+			}
+			fields = append(fields, "meta", string(meta))
+		}
+		return hexSha256(canonBytes(fields...))
+	}
+	return ""
+}
+
 // hashTx - hashes a given tranaction
 func (tx *txStruct) hashTx() {
 	defer fn.LogCondTrace(verblvl > 2)()
-	tim := fmt.Sprintf("%v", tx.TimeStamp)
-	src := sha256.Sum256([]byte(tx.Key + tx.Value + tim))
-	dst := make([]byte, hex.EncodedLen(len(src)))
-	hex.Encode(dst, src[:])
-	tx.ID = string(dst[:])
+	tx.HashVer = txhashver
+	tx.ID = tx.computeID()
 
 	fn.LogCondMsg(verblvl > 3, fmt.Sprintf("tx.Key=%v tx.ID=%v\n", tx.Key, tx.ID))
 }
 
-// cepTx - client entry point for: /tx?key=keyname&value=valuestring.
+// txReq - a /tx submission, from form values or a POST json body.
+type txReq struct {
+	Key      string            `json:"key"`
+	Value    string            `json:"value"`
+	PubKey   string            `json:"pubkey,omitempty"`
+	Sig      string            `json:"sig,omitempty"`
+	Delegate string            `json:"delegate,omitempty"`
+	PrevID   string            `json:"previd,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+// readTxReq - returns the submission in r: the json body of a POST with
+// content type application/json, else the form values (query or form body).
+func readTxReq(r *http.Request) (*txReq, *txErr) {
+	if ctype := r.Header.Get("Content-Type"); r.Method == http.MethodPost && ctype != "" {
+		mtype, _, err := mime.ParseMediaType(ctype)
+		switch {
+		case err != nil:
+			return nil, &txErr{http.StatusUnsupportedMediaType, ErrJSONdecodeBody,
+				fmt.Sprintf("invalid content type %q: %v", ctype, err)}
+		case mtype == "application/json":
+			req := &txReq{}
+			if err = decodeBody(r, req); err != nil {
+				return nil, &txErr{http.StatusBadRequest, ErrJSONdecodeBody,
+					"error decoding json body: " + err.Error()}
+			}
+			return req, nil
+		case mtype != "application/x-www-form-urlencoded" && mtype != "multipart/form-data":
+			return nil, &txErr{http.StatusUnsupportedMediaType, ErrJSONdecodeBody,
+				fmt.Sprintf("unsupported content type %q; use application/json or form values", mtype)}
+		}
+	}
+	return &txReq{Key: r.FormValue("key"), Value: r.FormValue("value"), PubKey: r.FormValue("pubkey"),
+		Sig: r.FormValue("sig"), Delegate: r.FormValue("delegate"), PrevID: r.FormValue("previd")}, nil
+}
+
+// newTx - returns the transaction submitted by req; signature checked,
+// timestamped and hashed.
+func (req *txReq) newTx() (*txStruct, *txErr) {
+	tx := &txStruct{Key: req.Key, Value: req.Value, PubKey: req.PubKey, Sig: req.Sig,
+		Delegate: req.Delegate, PrevID: req.PrevID, Meta: req.Meta}
+	if terr := tx.checkSig(); terr != nil {
+		return nil, terr
+	}
+	now := clk.Now()
+	tx.TimeStamp, tx.TimeStampNs = now.Unix(), now.UnixNano()
+	tx.hashTx()
+	return tx, nil
+}
+
+// cepTx - client entry point for: /tx?key=keyname&value=valuestring[&pubkey=hex&sig=hex[&previd=id][&delegate=hex]]
+// or POST /tx with a json body of txReq, a signature also covers its meta (see
+// signBytes); [&wait=commit[&timeout=duration]] see wait.go
 func cepTx(w http.ResponseWriter, r *http.Request) {
 	defer fn.LogCondTrace(devMode || verblvl > 2)()
-	key := r.FormValue("key")
-	val := r.FormValue("value")
-	if key == "" || val == "" {
-		msg := fmt.Sprintf("Error: both tranaction key and value must be set; key=%q value=%q", key, val)
-		bytes, jerr := json.Marshal(errStruct{ClientErrMsg: msg})
-		if jerr != nil {
-			sendHTTPError(w, http.StatusInternalServerError, ErrJSONmarshal,
-				"error JSON marshal of transaction", callerPar())
-			return
-		}
-		writeJSON(w, http.StatusBadRequest, bytes, bytes, true)
+	req, terr := readTxReq(r)
+	if terr != nil {
+		sendHTTPError(w, terr.scode, terr.code, terr.msg, callerPar())
+		return
+	}
+	if req.Key == "" || req.Value == "" {
+		sendClientError(w, http.StatusBadRequest, fmt.Sprintf(
+			"Error: both tranaction key and value must be set; key=%q value=%q", req.Key, req.Value))
 		return
 	}
 
-	tx := &txStruct{Key: key, Value: val, TimeStamp: time.Now().Unix()}
-	tx.hashTx()
+	wait, timeout, msg := parseWait(r)
+	if msg != "" {
+		sendClientError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	tx, terr := req.newTx()
+	if terr != nil {
+		sendHTTPError(w, terr.scode, terr.code, terr.msg, callerPar())
+		return
+	}
+	var wake chan struct{}
+	if wait {
+		wake = subscribe()
+		defer unsubscribe(wake)
+	}
+	if terr := tx.addToBlock(); terr != nil {
+		sendHTTPError(w, terr.scode, terr.code, terr.msg, callerPar())
+		return
+	}
+	if wait {
+		st, ok := waitCommitted(r, tx.ID, wake, timeout)
+		scode := http.StatusCreated
+		if !ok {
+			scode = http.StatusGatewayTimeout
+		}
+		sendJSON(w, scode, st, verblvl > 2)
+		return
+	}
 	bytes, jerr := json.Marshal(tx)
 	if jerr != nil {
 		sendHTTPError(w, http.StatusInternalServerError, ErrJSONmarshal,
 			"error JSON marshal of transaction", callerPar())
 		return
 	}
-	tx.addToBlock()
 
 	writeJSON(w, http.StatusCreated, bytes, bytes, verblvl > 2)
 }
 
+type searchResult struct {
+	Key       string     `json:"key"`
+	Committed []txLoc    `json:"committed"`
+	Pending   []txStruct `json:"pending"`
+}
+
+// searchKey - finds all committed (indexed) and pending (in blk) transactions for 'key'.
+func searchKey(key string) *searchResult {
+	defer fn.LogCondTrace(verblvl > 2)()
+	// hold bcmu so a block being committed is seen either pending or committed.
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	res := &searchResult{Key: key, Committed: lookupKey(key), Pending: []txStruct{}}
+	for _, tx := range blk.Transactions {
+		if tx.Key == key {
+			res.Pending = append(res.Pending, tx)
+		}
+	}
+	return res
+}
+
 // cepSearchTx - client entry point for: /searchtx?key=keyname.
 func cepSearchTx(w http.ResponseWriter, r *http.Request) {
 	defer fn.LogCondTrace(devMode || verblvl > 2)()
-
-	msg := fmt.Sprintf("Error: not implemented yet")
-	bytes, jerr := json.Marshal(errStruct{ClientErrMsg: msg})
-	if jerr != nil {
-		sendHTTPError(w, http.StatusInternalServerError, ErrJSONmarshal,
-			"error JSON marshal of transaction", callerPar())
+	key := r.FormValue("key")
+	if key == "" {
+		sendClientError(w, http.StatusBadRequest, "Error: search transaction key must be set")
 		return
 	}
-	writeJSON(w, http.StatusNotImplemented, bytes, bytes, true)
-	return
 
-	//key := r.FormValue("key")
-	//if key == "" {
-	//	log.Println("search transaction key missing")
-	//	return
-	//}
+	sendJSON(w, http.StatusOK, searchKey(key), verblvl > 2)
+}
+
+// tx states (txState.Status).
+const (
+	txStatusPending   = "pending"   // in blk, not yet committed.
+	txStatusCommitted = "committed" // in a committed block.
+)
+
+// txState - a transaction and where it is; Invocation, BlockHash and Height
+// are set only if committed, Position is within blk if pending.
+type txState struct {
+	Status     string   `json:"status"`
+	Invocation string   `json:"invocation,omitempty"`
+	BlockHash  string   `json:"block-hash,omitempty"`
+	Height     *uint64  `json:"height,omitempty"`
+	Position   int      `json:"position"`
+	Tx         txStruct `json:"transaction"`
+}
+
+// findTx - finds the pending (in blk) or committed (indexed) transaction with ID 'id'.
+func findTx(id string) (*txState, bool) {
+	defer fn.LogCondTrace(verblvl > 2)()
+	// hold bcmu so a block being committed is seen either pending or committed.
+	bcmu.Lock()
+	defer bcmu.Unlock()
+
+	for i, tx := range blk.Transactions {
+		if tx.ID == id {
+			return &txState{Status: txStatusPending, Position: i, Tx: tx}, true
+		}
+	}
+	loc, ok := lookupTx(id)
+	if !ok {
+		return nil, false
+	}
+	return committedState(loc), true
+}
+
+// committedState - returns the txState of committed transaction loc.
+func committedState(loc txLoc) *txState {
+	return &txState{Status: txStatusCommitted, Invocation: loc.Invocation, BlockHash: loc.BlockHash,
+		Height: &loc.Height, Position: loc.Position, Tx: loc.Tx}
+}
+
+// isTxID - returns true if 'id' is formatted as a tx ID: 64 lowercase hex digits.
+func isTxID(id string) bool {
+	if len(id) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// cepTxID - client entry point for: /tx/{id}.
+func cepTxID(w http.ResponseWriter, r *http.Request) {
+	defer fn.LogCondTrace(devMode || verblvl > 2)()
+	id := mux.Vars(r)["id"]
+	if !isTxID(id) {
+		sendClientError(w, http.StatusBadRequest,
+			fmt.Sprintf("Error: id=%q is not a tx ID (64 lowercase hex digits)", id))
+		return
+	}
+	st, ok := findTx(id)
+	if !ok {
+		sendHTTPError(w, http.StatusNotFound, ErrTxNotFound,
+			fmt.Sprintf("no pending or committed tx with id=%q", id), callerPar())
+		return
+	}
+	sendJSON(w, http.StatusOK, st, verblvl > 2)
 }
 
 // cepSrvShutdown - client entry point for: /srvshutdown.
@@ -297,17 +606,17 @@ func routesSetup() *http.Server {
 		r.PathPrefix("/debug/vars").Handler(http.DefaultServeMux)
 	}
 
-	r.HandleFunc("/tx", cepTx)
-	r.HandleFunc("/searchtx", cepSearchTx)
-
-	if srvsdenable {
-		r.HandleFunc("/srvshutdown", cepSrvShutdown)
+	routes := registerRoutes(r)
+	var err error
+	if openapiJSON, err = json.Marshal(openapiDoc(routes)); err != nil {
+		logPanic(err)
 	}
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", srvurl, srvport),
 		Handler: r,
 	}
+	server.RegisterOnShutdown(endEvents)
 	return server
 }
 
@@ -335,18 +644,10 @@ func catchProcessTerminate() {
 	}()
 }
 
-func blkchainFileSize() (cursize int64) {
-	fi, err := os.Stat(blkfile)
-	if err != nil {
-		logPanic(err)
-	}
-	return fi.Size()
-}
-
-func blkchainFileStat(msg string) {
-	size := blkchainFileSize()
-	fn.LogCondMsg(true, fmt.Sprintf("blkfile:%q %sSize:%d (MiB:%.4f)\n",
-		blkfile, msg, size, float64(size)/(1024.0*1024)))
+func blkstoreStat(msg string) {
+	size := blkstore.size()
+	fn.LogCondMsg(true, fmt.Sprintf("blkstore:%q blkfile:%q %sSize:%d (MiB:%.4f)\n",
+		blkstorename, blkfile, msg, size, float64(size)/(1024.0*1024)))
 	return
 }
 
@@ -356,18 +657,35 @@ func APIserver() (msg string, excode int) {
 	catchProcessTerminate()
 	excode = ExcodeGeneralError
 
-	var err error
-	// skipped O_APPEND because using seek.
-	blkfilep, err = os.OpenFile(blkfile, os.O_CREATE|os.O_RDWR, 0600)
+	blkstore = blkStores[blkstorename]()
+	if err := blkstore.open(); err != nil {
+		excode = ExcodeFileOpenErr
+		switch err.(type) {
+		case *corruptErr, *formatErr:
+			excode = ExcodeFileDecodeErr
+		}
+		return fmt.Sprintf("error opening blkstore:%q err=%v", blkstorename, err), excode
+	}
+	defer func() { _ = blkstore.close() }()
+
+	openingFileSize = blkstore.size()
+	if err := buildIndex(); err != nil {
+		return fmt.Sprintf("error indexing blkstore:%q err=%v", blkstorename, err), ExcodeFileDecodeErr
+	}
+	head, err := blkstore.headHash()
 	if err != nil {
-		return fmt.Sprintf("error opening file:%q err=%v", blkfile, err), ExcodeFileOpenErr
+		return fmt.Sprintf("error reading blkstore:%q err=%v", blkstorename, err), ExcodeFileDecodeErr
 	}
-	defer func() { _ = blkfilep.Close() }()
 
-	openingFileSize = blkchainFileSize()
+	// link this invocation's first block to the head of the chain in blkstore,
+	// only an empty blkstore starts a new chain with a genesis block.
+	blk.PrevHash = genesisPrevHash
+	if head != "" {
+		blk.PrevHash = head
+	}
 
 	if verblvl > 1 {
-		blkchainFileStat("opening")
+		blkstoreStat("opening")
 	}
 	server := routesSetup()
 	var srvmsg string
@@ -382,7 +700,9 @@ func APIserver() (msg string, excode int) {
 	code := <-signalCh
 	switch code {
 	case sigTerminate, sigSrvShutdownReq:
-		if err := server.Shutdown(nil); err != nil {
+		// commit the pending block first so /tx?wait=commit clients are answered.
+		blk.flush()
+		if err := server.Shutdown(context.Background()); err != nil {
 			logPanic(err)
 		}
 		stopTimerFlushBlk()
@@ -401,21 +721,21 @@ func APIserver() (msg string, excode int) {
 		logPanic(fmt.Sprintf("unrecognized code:%v", code))
 	}
 
-	// add closing json syntax if any blocks where written on this invocation.
+	// add closing syntax (if format has any) if any blocks where written on this invocation.
 	if totblkappSinv > 0 {
-		bytesAdd := "]}"
-		if _, err := blkfilep.Write([]byte(bytesAdd)); err != nil {
+		n, err := blkstore.closeInv()
+		if err != nil {
 			logPanic("appendWriteError:" + err.Error())
 		}
-		atomic.AddUint64(&totwrtbytesSinv, uint64(len(bytesAdd)))
+		atomic.AddUint64(&totwrtbytesSinv, uint64(n))
 	}
 
 	if verblvl > 1 {
 		fn.LogCondMsg(true, fmt.Sprintf(".......blocks-SinvAppended:%d\n", atomic.LoadUint64(&totblkappSinv)))
 		fn.LogCondMsg(true, fmt.Sprintf(".......trans--SinvAppended:%d\n", atomic.LoadUint64(&tottxappSinv)))
 		fn.LogCondMsg(true, fmt.Sprintf(".......bytes--SinvWritten.:%d\n", atomic.LoadUint64(&totwrtbytesSinv)))
-		fn.LogCondMsg(true, fmt.Sprintf("begToend-SinvFilesizeDelta:%d\n", blkchainFileSize()-openingFileSize))
-		blkchainFileStat("closing")
+		fn.LogCondMsg(true, fmt.Sprintf("begToend-SinvFilesizeDelta:%d\n", blkstore.size()-openingFileSize))
+		blkstoreStat("closing")
 	}
 
 	return msg, excode
@@ -0,0 +1,57 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTxID(t *testing.T) {
+	newTestChain(t)
+	committed := mustAddTx(t, "k", "v1")
+	blk.flush()
+	pending := mustAddTx(t, "k", "v2")
+
+	tests := []struct {
+		name   string
+		id     string
+		scode  int
+		status string
+	}{
+		{"committed", committed.ID, http.StatusOK, txStatusCommitted},
+		{"pending", pending.ID, http.StatusOK, txStatusPending},
+		{"unknown", strings.Repeat("a", 64), http.StatusNotFound, ""},
+		{"uppercase", strings.ToUpper(committed.ID), http.StatusBadRequest, ""},
+		{"short", committed.ID[:63], http.StatusBadRequest, ""},
+		{"not hex", strings.Repeat("z", 64), http.StatusBadRequest, ""},
+		{"batch", "batch", http.StatusBadRequest, ""},
+	}
+	for _, tc := range tests {
+		w := serveTest(http.MethodGet, "/v1/tx/"+tc.id, nil)
+		if w.Code != tc.scode {
+			t.Errorf("%s: status %d want %d: %s", tc.name, w.Code, tc.scode, w.Body.String())
+			continue
+		}
+		if tc.scode != http.StatusOK {
+			continue
+		}
+		var st txState
+		if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+			t.Fatalf("%s: response %q err:%v", tc.name, w.Body.String(), err)
+		}
+		if st.Status != tc.status || st.Tx.ID != tc.id {
+			t.Errorf("%s: status %q id %q want %q %q", tc.name, st.Status, st.Tx.ID, tc.status, tc.id)
+		}
+	}
+
+	// the literal batch route is not shadowed by /tx/{id}.
+	w := serveTest(http.MethodPost, "/v1/tx/batch", strings.NewReader(`{"transactions":[{"key":"k","value":"v3"}]}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("batch: status %d want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+}
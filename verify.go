@@ -0,0 +1,226 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to verifying a blockchain (-verify).
+
+// verifyErr - the first mismatch found while verifying a blockchain.
+type verifyErr struct {
+	Invocation string // invocation group of the block.
+	BlkIdx     int    // index of the block within its invocation group.
+	TxIdx      int    // index of the tx within its block, -1 if not tx related.
+	Msg        string
+}
+
+func (e *verifyErr) Error() string {
+	if e.TxIdx < 0 {
+		return fmt.Sprintf("invocation:%s block:%d: %s", e.Invocation, e.BlkIdx, e.Msg)
+	}
+	return fmt.Sprintf("invocation:%s block:%d tx:%d: %s", e.Invocation, e.BlkIdx, e.TxIdx, e.Msg)
+}
+
+// verifyStats - what was verified in a blockchain.
+type verifyStats struct {
+	invocations int
+	blocks      int
+	txs         int
+	legacy      int    // blocks of blkHashVerLegacy, these all precede newer ones.
+	restarts    int    // legacy invocation groups starting a new chain instead of linking to the prior group.
+	head        string // hash of last block.
+}
+
+// verifyChain - recomputes each tx ID and block hash (per its HashVer) of doc
+// and checks that no block has a tx ID twice, that each signed tx's PrevID is
+// its key's last tx, that each block's PrevHash links to the block before it
+// and its Height (if its HashVer has one) is its position. Only the first
+// block may link to genesisPrevHash, except that legacy blocks
+// (blkHashVerLegacy, written before invocations were linked) may restart the
+// chain at the start of an invocation group.
+func verifyChain(doc blkchainDoc) (st verifyStats, verr *verifyErr) {
+	defer fn.LogCondTrace(verblvl > 1)()
+	prev := genesisPrevHash
+	lastIDs := make(map[string]string) // key to the ID of its last tx.
+	for _, g := range doc {
+		st.invocations++
+		for bi := range g.Blocks {
+			b := &g.Blocks[bi]
+			ids := make(map[string]bool, len(b.Transactions))
+			for ti := range b.Transactions {
+				tx := &b.Transactions[ti]
+				if id := tx.computeID(); id != tx.ID {
+					return st, &verifyErr{g.Name, bi, ti, fmt.Sprintf("tx ID:%s computed:%s", tx.ID, id)}
+				}
+				if ids[tx.ID] {
+					return st, &verifyErr{g.Name, bi, ti, fmt.Sprintf("tx ID:%s duplicated in block", tx.ID)}
+				}
+				ids[tx.ID] = true
+				if tx.PubKey != "" || tx.Sig != "" {
+					if terr := tx.checkSig(); terr != nil {
+						return st, &verifyErr{g.Name, bi, ti, "signature: " + terr.msg}
+					}
+					if tx.PrevID != lastIDs[tx.Key] {
+						return st, &verifyErr{g.Name, bi, ti, fmt.Sprintf("previd:%q key's last tx:%q",
+							tx.PrevID, lastIDs[tx.Key])}
+					}
+				}
+				lastIDs[tx.Key] = tx.ID
+				st.txs++
+			}
+			switch b.HashVer {
+			case blkHashVerLegacy:
+				if st.blocks > st.legacy {
+					return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("hashver %d block after a newer one", b.HashVer)}
+				}
+				st.legacy++
+				if b.MerkleRoot != "" {
+					return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("merkle root:%s in a hashver %d block",
+						b.MerkleRoot, b.HashVer)}
+				}
+			case blkHashVerCanon:
+				if root, _ := b.computeMerkleRoot(); root != b.MerkleRoot {
+					return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("merkle root:%s computed:%s", b.MerkleRoot, root)}
+				}
+				if b.Height != uint64(st.blocks) {
+					return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("height:%d expected:%d", b.Height, st.blocks)}
+				}
+			default:
+				return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("unknown block hashver:%d", b.HashVer)}
+			}
+			if hash := b.computeHash(); hash != b.BlockHash {
+				return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("block hash:%s computed:%s", b.BlockHash, hash)}
+			}
+			if b.PrevHash != prev {
+				// only legacy blocks, written before invocations were linked, may
+				// restart the chain at the start of an invocation group.
+				if bi != 0 || b.PrevHash != genesisPrevHash || b.HashVer != blkHashVerLegacy {
+					return st, &verifyErr{g.Name, bi, -1, fmt.Sprintf("prev hash:%s expected:%s", b.PrevHash, prev)}
+				}
+				st.restarts++
+			}
+			prev = b.BlockHash
+			st.head = b.BlockHash
+			st.blocks++
+		}
+	}
+	return st, nil
+}
+
+// verifyLoad - loads blkchain file 'fname' for verifying, msg and excode are
+// set only if it can not be loaded.
+func verifyLoad(fname string) (doc blkchainDoc, msg string, excode int) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Sprintf("verify:%q error reading file err=%v", fname, err), ExcodeFileOpenErr
+	}
+	if len(data) == 0 {
+		return nil, "", ExcodeNoError
+	}
+
+	// the format of the file, not -blk.format, which may differ from it.
+	bf := blkfmt
+	if f := formatOf(data); f != "" {
+		bf = blkFormats[f]
+	}
+	good, _, complete, err := bf.goodLen(data)
+	if err != nil {
+		return nil, fmt.Sprintf("verify:%q corrupt: err=%v", fname, err), ExcodeVerifyCorrupt
+	}
+	if !complete {
+		return nil, fmt.Sprintf("verify:%q corrupt: json is incomplete after offset %d",
+			fname, good), ExcodeVerifyCorrupt
+	}
+	if doc, err = bf.decode(data, false); err != nil {
+		return nil, fmt.Sprintf("verify:%q corrupt: err=%v", fname, err), ExcodeVerifyCorrupt
+	}
+	return doc, "", ExcodeNoError
+}
+
+// verifyLoadManifest - loads the segments listed by manifest 'fname' (see
+// segStore) as one blockchain, checking each segment's first block PrevHash
+// against the manifest.
+func verifyLoadManifest(fname string) (doc blkchainDoc, msg string, excode int) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Sprintf("verify:%q error reading file err=%v", fname, err), ExcodeFileOpenErr
+	}
+	var m segManifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Sprintf("verify:%q corrupt: err=%v", fname, err), ExcodeVerifyCorrupt
+	}
+
+	for _, e := range m.Segments {
+		sdoc, msg, excode := verifyLoad(filepath.Join(filepath.Dir(fname), e.File))
+		if excode != ExcodeNoError {
+			return nil, msg, excode
+		}
+		if len(sdoc) > 0 && len(sdoc[0].Blocks) > 0 && sdoc[0].Blocks[0].PrevHash != e.PrevHash {
+			return nil, fmt.Sprintf("verify:%q tampered: segment:%q prev hash:%s manifest:%s",
+				fname, e.File, sdoc[0].Blocks[0].PrevHash, e.PrevHash), ExcodeVerifyTampered
+		}
+		doc = doc.concat(sdoc)
+	}
+	return doc, "", ExcodeNoError
+}
+
+// segManifestOf - returns the manifest (*manifest.json) in the directory of
+// segment 'fname' listing it after its first segment, "" if there is none.
+func segManifestOf(fname string) string {
+	names, _ := filepath.Glob(filepath.Join(filepath.Dir(fname), "*manifest.json"))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var m segManifest
+		if json.Unmarshal(data, &m) != nil {
+			continue
+		}
+		for i, e := range m.Segments {
+			if i > 0 && e.File == filepath.Base(fname) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// verifyBlkfile - verifies blkchain file 'fname' end to end, if fname is a
+// segment manifest (*manifest.json) its segments are verified as one chain.
+// A segment continuing the chain of an earlier one is not verified alone.
+func verifyBlkfile(fname string) (msg string, excode int) {
+	defer fn.LogCondTrace(verblvl > 1)()
+	manifest := strings.HasSuffix(fname, "manifest.json")
+	load := verifyLoad
+	if manifest {
+		load = verifyLoadManifest
+	}
+	doc, msg, excode := load(fname)
+	if excode != ExcodeNoError {
+		return msg, excode
+	}
+	if !manifest && len(doc) > 0 && len(doc[0].Blocks) > 0 && doc[0].Blocks[0].PrevHash != genesisPrevHash {
+		if m := segManifestOf(fname); m != "" {
+			return fmt.Sprintf("verify:%q is a segment continuing the chain of manifest %q; verify that instead",
+				fname, m), ExcodeVerifySegment
+		}
+	}
+
+	st, verr := verifyChain(doc)
+	if verr != nil {
+		return fmt.Sprintf("verify:%q tampered: %v", fname, verr), ExcodeVerifyTampered
+	}
+	return fmt.Sprintf("verify:%q ok: invocations:%d blocks:%d txs:%d restarts:%d head:%q",
+		fname, st.invocations, st.blocks, st.txs, st.restarts, st.head), ExcodeNoError
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyDoc - returns a copy of doc that can be changed without changing doc.
+func copyDoc(doc blkchainDoc) blkchainDoc {
+	c := make(blkchainDoc, len(doc))
+	for i, g := range doc {
+		c[i] = invGroup{Name: g.Name, Blocks: make([]Blk, len(g.Blocks))}
+		for j, b := range g.Blocks {
+			b.Transactions = append([]txStruct{}, b.Transactions...)
+			c[i].Blocks[j] = b
+		}
+	}
+	return c
+}
+
+// rehash - recomputes the merkle root and hash of block b, as someone
+// tampering with it would.
+func rehash(b *Blk) {
+	if b.HashVer != blkHashVerLegacy {
+		b.MerkleRoot, _ = b.computeMerkleRoot()
+	}
+	b.BlockHash = b.computeHash()
+}
+
+// legacyBlk - returns a blkHashVerLegacy block linked to 'prev' with a
+// legacy tx, as written before block hash versions.
+func legacyBlk(prev, value string) Blk {
+	tx := txStruct{Key: "k", Value: value, TimeStamp: testStart.Unix()}
+	tx.ID = tx.computeID()
+	b := Blk{PrevHash: prev, Transactions: []txStruct{tx}}
+	b.BlockHash = b.computeHash()
+	return b
+}
+
+func TestVerifyChain(t *testing.T) {
+	doc := testBlocks(t, 3, 2)
+	legacy := blkchainDoc{{Name: "invts-1", Blocks: []Blk{legacyBlk(genesisPrevHash, "a")}}}
+	legacy[0].Blocks = append(legacy[0].Blocks, legacyBlk(legacy[0].Blocks[0].BlockHash, "b"))
+	legacy = append(legacy, invGroup{Name: "invts-2", Blocks: []Blk{legacyBlk(genesisPrevHash, "c")}})
+
+	tests := []struct {
+		name   string
+		doc    blkchainDoc
+		tamper func(d blkchainDoc) blkchainDoc
+		want   string // in the verifyErr message, "" if it verifies.
+	}{
+		{"untouched", doc, nil, ""},
+		{"tx value", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks[1].Transactions[0].Value = "x"
+			return d
+		}, "tx ID"},
+		{"tx value and ID", doc, func(d blkchainDoc) blkchainDoc {
+			tx := &d[0].Blocks[1].Transactions[0]
+			tx.Value = "x"
+			tx.ID = tx.computeID()
+			return d
+		}, "merkle root"},
+		{"tx value, ID and merkle root", doc, func(d blkchainDoc) blkchainDoc {
+			b := &d[0].Blocks[1]
+			b.Transactions[0].Value = "x"
+			b.Transactions[0].ID = b.Transactions[0].computeID()
+			b.MerkleRoot, _ = b.computeMerkleRoot()
+			return d
+		}, "block hash"},
+		{"rehashed block", doc, func(d blkchainDoc) blkchainDoc {
+			b := &d[0].Blocks[1]
+			b.Transactions[0].Value = "x"
+			b.Transactions[0].ID = b.Transactions[0].computeID()
+			rehash(b)
+			return d
+		}, "prev hash"},
+		{"dropped block", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks = append(d[0].Blocks[:1], d[0].Blocks[2:]...)
+			return d
+		}, "height"},
+		{"swapped blocks", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks[1], d[0].Blocks[2] = d[0].Blocks[2], d[0].Blocks[1]
+			return d
+		}, "height"},
+		{"rehashed height", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks[2].Height = 5
+			rehash(&d[0].Blocks[2])
+			return d
+		}, "height"},
+		{"genesis prev hash after first block", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks = d[0].Blocks[1:]
+			for i := range d[0].Blocks {
+				b := &d[0].Blocks[i]
+				b.Height = uint64(i + 1)
+				if i == 0 {
+					b.PrevHash = genesisPrevHash
+				} else {
+					b.PrevHash = d[0].Blocks[i-1].BlockHash
+				}
+				rehash(b)
+			}
+			return append(blkchainDoc{{Name: "invts-0", Blocks: []Blk{doc[0].Blocks[0]}}}, d...)
+		}, "prev hash"},
+		{"duplicate tx", doc, func(d blkchainDoc) blkchainDoc {
+			b := &d[0].Blocks[2]
+			b.Transactions = append(b.Transactions, b.Transactions[0])
+			rehash(b)
+			return d
+		}, "duplicated"},
+		{"unknown hashver", doc, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks[2].HashVer = 7
+			return d
+		}, "unknown block hashver"},
+		{"legacy block after newer", doc, func(d blkchainDoc) blkchainDoc {
+			g := &d[0]
+			g.Blocks = append(g.Blocks, legacyBlk(g.Blocks[len(g.Blocks)-1].BlockHash, "x"))
+			return d
+		}, "after a newer one"},
+		{"legacy restarts", legacy, nil, ""},
+		{"legacy restart within a group", legacy, func(d blkchainDoc) blkchainDoc {
+			d[0].Blocks[1] = legacyBlk(genesisPrevHash, "b")
+			return d
+		}, "prev hash"},
+		{"legacy merkle root", legacy, func(d blkchainDoc) blkchainDoc {
+			d[1].Blocks[0].MerkleRoot = d[0].Blocks[0].BlockHash
+			return d
+		}, "merkle root"},
+	}
+
+	for _, tc := range tests {
+		d := copyDoc(tc.doc)
+		if tc.tamper != nil {
+			d = tc.tamper(d)
+		}
+		_, verr := verifyChain(d)
+		switch {
+		case tc.want == "" && verr != nil:
+			t.Errorf("%s: err:%v", tc.name, verr)
+		case tc.want != "" && verr == nil:
+			t.Errorf("%s: verified want err %q", tc.name, tc.want)
+		case tc.want != "" && !strings.Contains(verr.Msg, tc.want):
+			t.Errorf("%s: err:%v want %q", tc.name, verr, tc.want)
+		}
+	}
+}
+
+func TestVerifyBlkfile(t *testing.T) {
+	doc := testBlocks(t, 3, 2)
+	dir, err := ioutil.TempDir("", "blkchain-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	blkfmt = jsonFormat{} // the default -blk.format.
+
+	writeTestFile(t, filepath.Join(dir, "blkchain.json"), jsonFormat{}, doc)
+	writeTestFile(t, filepath.Join(dir, "blkchain.jsonl"), jsonlFormat{}, doc)
+	// segments of a block each, as a rotated blkchain.jsonl.
+	s := &segStore{dir: filepath.Join(dir, "segs"), manifest: "blkchain-manifest.json", maxbytes: 1,
+		fmt: jsonlFormat{}, segName: func(i int) string { return fmt.Sprintf("blkchain-%06d.jsonl", i) }}
+	if err = s.open(); err != nil {
+		t.Fatalf("open err:%v", err)
+	}
+	for i := range doc[0].Blocks {
+		if _, _, err = s.appendBlk(doc[0].Name, i == 0, &doc[0].Blocks[i]); err != nil {
+			t.Fatalf("appendBlk err:%v", err)
+		}
+	}
+	if _, err = s.closeInv(); err != nil {
+		t.Fatalf("closeInv err:%v", err)
+	}
+	if err = s.close(); err != nil {
+		t.Fatalf("close err:%v", err)
+	}
+	// a segment after the first without its manifest.
+	data, err := ioutil.ReadFile(filepath.Join(dir, "segs", "blkchain-000002.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "lone.jsonl"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file   string
+		excode int
+	}{
+		{"blkchain.json", ExcodeNoError},
+		{"blkchain.jsonl", ExcodeNoError}, // not in -blk.format.
+		{"segs/blkchain-manifest.json", ExcodeNoError},
+		{"segs/blkchain-000001.jsonl", ExcodeNoError},
+		{"segs/blkchain-000002.jsonl", ExcodeVerifySegment},
+		{"segs/blkchain-000003.jsonl", ExcodeVerifySegment},
+		{"lone.jsonl", ExcodeVerifyTampered},
+	}
+	for _, tc := range tests {
+		msg, excode := verifyBlkfile(filepath.Join(dir, tc.file))
+		if excode != tc.excode {
+			t.Errorf("%s: excode %d want %d: %s", tc.file, excode, tc.excode, msg)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/phcurtis/fn"
+)
+
+// this file contains functions related to waiting for a submitted transaction
+// to be committed (/tx?wait=commit). Blocks are fsynced as append2File
+// commits them, so a committed transaction is a durable one.
+
+// waitCommit - /tx wait value to hold the response until the tx is committed.
+const waitCommit = "commit"
+
+// /tx?wait=commit timeout limits.
+const (
+	waitTimeoutDef = 30 * time.Second
+	waitTimeoutMax = 10 * time.Minute
+)
+
+// parseWait - returns whether r asks to wait for its tx to be committed and
+// for how long; msg is set if r's wait or timeout are invalid.
+func parseWait(r *http.Request) (wait bool, timeout time.Duration, msg string) {
+	switch s := r.FormValue("wait"); s {
+	case "":
+		return false, 0, ""
+	case waitCommit:
+	default:
+		return false, 0, fmt.Sprintf("Error: wait must be %s; wait=%q", waitCommit, s)
+	}
+
+	timeout = waitTimeoutDef
+	if s := r.FormValue("timeout"); s != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s); err != nil || timeout <= 0 || timeout > waitTimeoutMax {
+			return false, 0, fmt.Sprintf("Error: timeout must be a duration up to %v; timeout=%q", waitTimeoutMax, s)
+		}
+	}
+	return true, timeout, ""
+}
+
+// waitCommitted - waits until the tx with ID 'id' is committed, 'timeout'
+// (per clk) passes, r's client goes away or the server shuts down; returns the
+// tx's state and true if committed. wake must be subscribed before the tx was added.
+func waitCommitted(r *http.Request, id string, wake chan struct{}, timeout time.Duration) (*txState, bool) {
+	defer fn.LogCondTrace(verblvl > 2)()
+	deadline := make(chan struct{})
+	timer := clk.AfterFunc(timeout, func() { close(deadline) })
+	defer timer.Stop()
+
+	for {
+		st, ok := findTx(id)
+		if !ok {
+			logPanic(fmt.Sprintf("added tx id=%q not found", id))
+		}
+		if st.Status == txStatusCommitted {
+			return st, true
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			return st, false
+		case <-r.Context().Done():
+			return st, false
+		case <-eventsDone:
+			return st, false
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 phcurtis blkchain Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitTimers - waits until 'n' timers are set on fc.
+func waitTimers(t *testing.T, fc *fakeClock, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		fc.mu.Lock()
+		got := len(fc.timers)
+		fc.mu.Unlock()
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("timers not set want %d", n)
+}
+
+func TestWaitCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		txmax   int
+		timers  int // set once the tx is added: its block's commit and its wait.
+		advance time.Duration
+		scode   int
+		status  string
+	}{
+		{"committed with its block", "wait=commit&timeout=90s", 0, 2, time.Minute,
+			http.StatusCreated, txStatusCommitted},
+		{"committed at max txs", "wait=commit", 1, 0, 0, http.StatusCreated, txStatusCommitted},
+		{"timed out", "wait=commit&timeout=30s", 0, 2, 30 * time.Second,
+			http.StatusGatewayTimeout, txStatusPending},
+		{"default timeout", "wait=commit", 0, 2, waitTimeoutDef,
+			http.StatusGatewayTimeout, txStatusPending},
+		{"timeout over max", "wait=commit&timeout=11m", 0, 0, 0, http.StatusBadRequest, ""},
+		{"timeout not a duration", "wait=commit&timeout=soon", 0, 0, 0, http.StatusBadRequest, ""},
+		{"unknown wait", "wait=block", 0, 0, 0, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range tests {
+		fc := newTestChain(t)
+		blktxmax = tc.txmax
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() { done <- serveTest(http.MethodGet, "/v1/tx?key=k&value=v&"+tc.query, nil) }()
+		if tc.timers > 0 {
+			waitTimers(t, fc, tc.timers)
+			fc.Advance(tc.advance)
+		}
+
+		var w *httptest.ResponseRecorder
+		select {
+		case w = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no response", tc.name)
+		}
+		if w.Code != tc.scode {
+			t.Errorf("%s: status %d want %d: %s", tc.name, w.Code, tc.scode, w.Body.String())
+			continue
+		}
+		if tc.status == "" {
+			continue
+		}
+		var st txState
+		if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+			t.Fatalf("%s: response %q err:%v", tc.name, w.Body.String(), err)
+		}
+		if st.Status != tc.status || (st.Status == txStatusCommitted) != (st.Height != nil) {
+			t.Errorf("%s: status %q height %v want %q", tc.name, st.Status, st.Height, tc.status)
+		}
+	}
+}